@@ -2,53 +2,240 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"skiff/pkg/config"
 	"skiff/pkg/diff"
+	"skiff/pkg/input"
 	"skiff/pkg/k8s"
 )
 
+// fingerprintKeyEnv names the environment variable holding the key for the
+// fingerprints of hidden values
+const fingerprintKeyEnv = "SKIFF_FINGERPRINT_KEY"
+
+// hasSensitiveChanges checks whether any field change had its values hidden
+func hasSensitiveChanges(result *diff.TerraformStyleResult) bool {
+	for _, resource := range result.ResourceChanges {
+		for _, change := range resource.Change.Changes {
+			if change.Sensitive {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// isFlagSet checks whether a flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 func main() {
-	if len(os.Args) != 3 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <before.yaml> <after.yaml>\n", os.Args[0])
-		os.Exit(1)
+	opts := diff.DefaultOptions()
+
+	pathFormat := flag.String("path-format", string(opts.PathFormat), "format of change paths: dot, bracket or pointer")
+	flag.BoolVar(&opts.IncludePath, "path-array", opts.IncludePath, "include the structured path of each change as an array")
+	flag.BoolVar(&opts.ConvertVersions, "convert-versions", opts.ConvertVersions, "convert objects that moved between known API versions before comparing")
+	flag.BoolVar(&opts.ApplyDefaults, "apply-defaults", opts.ApplyDefaults, "fill in the defaults the API server would set for workloads, Pods and Services before comparing")
+	flag.BoolVar(&opts.ShowSecrets, "show-secrets", opts.ShowSecrets, "show the decoded values of Secret data instead of redacting them")
+	flag.IntVar(&opts.TextDiffLines, "text-diff-lines", opts.TextDiffLines, "add a line diff to changed strings with at least this many lines (0 for off)")
+	namespace := flag.String("namespace", "", "namespace for namespaced objects that do not set one, like kubectl apply -n")
+	beforeNamespace := flag.String("namespace-before", "", "namespace for objects in <before> that do not set one (overrides --namespace)")
+	afterNamespace := flag.String("namespace-after", "", "namespace for objects in <after> that do not set one (overrides --namespace)")
+	duplicates := flag.String("duplicates", string(k8s.DuplicateError), "what to do when an input has two objects with the same key: error, warn or last-wins")
+	configPath := flag.String("config", config.FileName, "config file with ignore and mask rules; "+config.FileName+" is optional, an explicit file must exist")
+	serverFields := flag.String("server-fields", string(k8s.ServerFieldsAuto), "strip fields populated by the API server: auto (for inputs that look like a cluster export), always or never")
+	var include, exclude stringList
+	flag.Var(&include, "include", "only load files matching this glob from directories (repeatable)")
+	flag.Var(&exclude, "exclude", "skip files and directories matching this glob in directories (repeatable)")
+	var valuesBefore, valuesAfter, set stringList
+	flag.Var(&valuesBefore, "values-before", "values file for a <before> Helm chart (repeatable)")
+	flag.Var(&valuesAfter, "values-after", "values file for an <after> Helm chart (repeatable)")
+	flag.Var(&set, "set", "set a Helm chart value on both sides, like helm template --set (repeatable)")
+	helmOpts := input.HelmOptions{}
+	flag.StringVar(&helmOpts.ReleaseName, "release-name", input.DefaultReleaseName, "release name Helm charts are rendered with")
+	flag.BoolVar(&helmOpts.IncludeCRDs, "include-crds", false, "include the crds/ directory of Helm charts")
+	flag.BoolVar(&helmOpts.SkipHooks, "skip-hooks", false, "leave out Helm hooks, including tests")
+	flag.BoolVar(&helmOpts.SkipTests, "skip-tests", false, "leave out Helm test hooks")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <before> <after>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s git [flags] <rev-a> <rev-b> [-- <paths>...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Each of <before> and <after> is a YAML or JSON file, a directory of them, a kustomization\n")
+		fmt.Fprintf(os.Stderr, "directory, a Helm chart directory or .tgz, or - for stdin.\n")
+		fmt.Fprintf(os.Stderr, "In git mode, <paths> are read from both revisions of the repository in the current directory.\n")
+		fmt.Fprintf(os.Stderr, "Hidden values are fingerprinted with the key in $%s.\n\n", fingerprintKeyEnv)
+		flag.PrintDefaults()
+	}
+
+	args := os.Args[1:]
+	gitMode := len(args) > 0 && args[0] == "git"
+	if gitMode {
+		args = args[1:]
 	}
+	flag.CommandLine.Parse(args) // nolint:errcheck // exits on error
 
-	beforePath := os.Args[1]
-	afterPath := os.Args[2]
+	var gitPaths []string
+	if gitMode && flag.NArg() > 2 {
+		gitPaths = flag.Args()[2:]
+		if gitPaths[0] == "--" {
+			gitPaths = gitPaths[1:]
+		}
+	} else if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
 
-	beforeFile, err := os.Open(beforePath)
+	format, err := diff.ParsePathFormat(*pathFormat)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", beforePath, err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts.PathFormat = format
+
+	if opts.TextDiffLines < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --text-diff-lines must not be negative\n")
 		os.Exit(1)
 	}
-	defer beforeFile.Close() // nolint:errcheck
 
-	afterFile, err := os.Open(afterPath)
+	duplicatePolicy, err := k8s.ParseDuplicatePolicy(*duplicates)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening %s: %v\n", afterPath, err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	defer afterFile.Close() // nolint:errcheck
 
-	beforeObjects, err := k8s.ParseYAMLStream(beforeFile)
+	var cfg *config.Config
+	if isFlagSet("config") {
+		cfg, err = config.Load(*configPath)
+	} else {
+		cfg, err = config.LoadDefault()
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", beforePath, err)
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	opts.Ignore = cfg.Ignore
+	opts.Mask = cfg.Mask
+	opts.FingerprintKey = []byte(os.Getenv(fingerprintKeyEnv))
 
-	afterObjects, err := k8s.ParseYAMLStream(afterFile)
+	serverFieldsPolicy, err := k8s.ParseServerFieldsPolicy(*serverFields)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", afterPath, err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, globs := range [][]string{include, exclude} {
+		if err := input.ValidateGlobs(globs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	beforePath := flag.Arg(0)
+	afterPath := flag.Arg(1)
+	if !gitMode && beforePath == input.Stdin && afterPath == input.Stdin {
+		fmt.Fprintf(os.Stderr, "Error: only one of <before> and <after> can be read from stdin\n")
 		os.Exit(1)
 	}
 
-	result, err := diff.GenerateTerraformStyle(beforeObjects, afterObjects)
+	beforeOpts := input.Options{
+		Parse:   k8s.ParseOptions{DefaultNamespace: *namespace, Duplicates: duplicatePolicy, ServerFields: serverFieldsPolicy},
+		Include: include,
+		Exclude: exclude,
+		Helm:    helmOpts,
+	}
+	beforeOpts.Helm.ValueFiles = valuesBefore
+	beforeOpts.Helm.Set = set
+	if *beforeNamespace != "" {
+		beforeOpts.Parse.DefaultNamespace = *beforeNamespace
+	}
+	afterOpts := input.Options{
+		Parse:   k8s.ParseOptions{DefaultNamespace: *namespace, Duplicates: duplicatePolicy, ServerFields: serverFieldsPolicy},
+		Include: include,
+		Exclude: exclude,
+		Helm:    helmOpts,
+	}
+	afterOpts.Helm.ValueFiles = valuesAfter
+	afterOpts.Helm.Set = set
+	if *afterNamespace != "" {
+		afterOpts.Parse.DefaultNamespace = *afterNamespace
+	}
+
+	var beforeManifest, afterManifest *k8s.Manifest
+	var revisions *diff.Revisions
+	if gitMode {
+		revisions = &diff.Revisions{Before: diff.Revision{Ref: beforePath}, After: diff.Revision{Ref: afterPath}}
+		beforeManifest, revisions.Before.Commit, err = input.LoadGit(beforePath, gitPaths, beforeOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", beforePath, err)
+			os.Exit(1)
+		}
+		afterManifest, revisions.After.Commit, err = input.LoadGit(afterPath, gitPaths, afterOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", afterPath, err)
+			os.Exit(1)
+		}
+	} else {
+		beforeManifest, err = input.Load(beforePath, beforeOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", beforePath, err)
+			os.Exit(1)
+		}
+		afterManifest, err = input.Load(afterPath, afterOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", afterPath, err)
+			os.Exit(1)
+		}
+	}
+
+	// Key both sides with the CRDs of either, so a custom resource whose CRD is
+	// added or removed keeps its key
+	scopes := beforeManifest.Scopes.Merge(afterManifest.Scopes)
+	for _, manifest := range []*k8s.Manifest{beforeManifest, afterManifest} {
+		if err := manifest.Rekey(scopes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, warning := range append(beforeManifest.Warnings, afterManifest.Warnings...) {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", warning)
+	}
+
+	opts.Before = beforeManifest
+	opts.After = afterManifest
+
+	result, err := diff.GenerateTerraformStyleWithOptions(beforeManifest.Objects, afterManifest.Objects, opts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating diff: %v\n", err)
 		os.Exit(1)
 	}
+	result.Revisions = revisions
+
+	if len(opts.FingerprintKey) == 0 && hasSensitiveChanges(result) {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not set, hidden values have no fingerprints\n", fingerprintKeyEnv)
+	}
 
 	encoder := json.NewEncoder(os.Stdout)
 	encoder.SetIndent("", "  ")
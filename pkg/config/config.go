@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+
+	"skiff/pkg/diff"
+)
+
+// FileName is the config file skiff reads from the current directory by default
+const FileName = ".skiff.yaml"
+
+// Config is the content of a .skiff.yaml file
+type Config struct {
+	// Ignore lists fields whose changes are not reported
+	Ignore []diff.IgnoreRule `yaml:"ignore"`
+	// Mask lists fields whose values are hidden, like those of Secret data
+	Mask []diff.MaskRule `yaml:"mask"`
+}
+
+// Load reads and validates the config file at path
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// LoadDefault reads FileName from the current directory, returning an empty
+// config if there is none
+func LoadDefault() (*Config, error) {
+	config, err := Load(FileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return config, err
+}
+
+// Parse decodes and validates a config. Unknown fields are rejected so typos
+// do not silently disable a rule.
+func Parse(data []byte) (*Config, error) {
+	config := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that every rule can match something and that its keys compile
+func (c *Config) Validate() error {
+	for i, rule := range c.Ignore {
+		if len(rule.Paths) == 0 {
+			return fmt.Errorf("ignore rule %d has no paths", i+1)
+		}
+		for _, path := range rule.Paths {
+			if path == "" {
+				return fmt.Errorf("ignore rule %d has an empty path", i+1)
+			}
+		}
+	}
+	for i, rule := range c.Mask {
+		if len(rule.Paths) == 0 && rule.Keys == "" {
+			return fmt.Errorf("mask rule %d has no paths or keys", i+1)
+		}
+		for _, path := range rule.Paths {
+			if path == "" {
+				return fmt.Errorf("mask rule %d has an empty path", i+1)
+			}
+		}
+		if _, err := regexp.Compile(rule.Keys); err != nil {
+			return fmt.Errorf("mask rule %d has invalid keys: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"skiff/pkg/diff"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected []diff.IgnoreRule
+		wantErr  bool
+	}{
+		{
+			name: "ignore rules",
+			yaml: `ignore:
+- kind: Deployment
+  namespace: "*"
+  paths:
+  - metadata.annotations.checksum/*
+  - spec.template.metadata.annotations.checksum/*
+- paths: [metadata.labels.helm.sh/chart]
+- kind: Deployment
+  paths: ["spec.template.spec.containers[*].image"]
+  value: registry.example.com/*@sha256:*
+`,
+			expected: []diff.IgnoreRule{
+				{Kind: "Deployment", Namespace: "*", Paths: []string{"metadata.annotations.checksum/*", "spec.template.metadata.annotations.checksum/*"}},
+				{Paths: []string{"metadata.labels.helm.sh/chart"}},
+				{Kind: "Deployment", Paths: []string{"spec.template.spec.containers[*].image"}, Value: "registry.example.com/*@sha256:*"},
+			},
+		},
+		{
+			name: "empty file",
+			yaml: "",
+		},
+		{
+			name:    "rule without paths",
+			yaml:    "ignore:\n- kind: Deployment\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			yaml:    "ignore:\n- kind: Deployment\n  path: [spec.replicas]\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Parse([]byte(tt.yaml))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config.Ignore, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, config.Ignore)
+			}
+		})
+	}
+}
+
+func TestParseMask(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		expected []diff.MaskRule
+		wantErr  bool
+	}{
+		{
+			name: "mask rules",
+			yaml: `mask:
+- paths: ["*.env[*].value"]
+  keys: (?i)password|token
+- kind: ConfigMap
+  paths: [data]
+  keys: (?i)_URL$
+- kind: PostgresCluster
+  paths: [spec.credentials]
+`,
+			expected: []diff.MaskRule{
+				{Paths: []string{"*.env[*].value"}, Keys: "(?i)password|token"},
+				{Kind: "ConfigMap", Paths: []string{"data"}, Keys: "(?i)_URL$"},
+				{Kind: "PostgresCluster", Paths: []string{"spec.credentials"}},
+			},
+		},
+		{
+			name:     "keys only",
+			yaml:     "mask:\n- keys: (?i)password\n",
+			expected: []diff.MaskRule{{Keys: "(?i)password"}},
+		},
+		{
+			name:    "rule without paths or keys",
+			yaml:    "mask:\n- kind: ConfigMap\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid keys",
+			yaml:    "mask:\n- keys: \"(password\"\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Parse([]byte(tt.yaml))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config.Mask, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, config.Mask)
+			}
+		})
+	}
+}
@@ -2,14 +2,51 @@ package diff
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/google/go-cmp/cmp"
+
+	"skiff/pkg/k8s"
 )
 
 // TerraformStyleResult represents a flat diff format for easier policy writing
 type TerraformStyleResult struct {
 	ResourceChanges map[string]ResourceChange `json:"resource_changes"`
+	// Revisions records the git revisions that were compared, if any
+	Revisions *Revisions `json:"revisions,omitempty"`
+	// Suppressed lists changed resources and fields that were left out by
+	// ignore annotations or rules, keyed like ResourceChanges
+	Suppressed map[string]Suppression `json:"suppressed,omitempty"`
+}
+
+// Suppression records what was left out of the diff for one resource
+type Suppression struct {
+	// Resource is set when the whole resource was skipped with the
+	// skiff.io/ignore annotation
+	Resource bool `json:"resource,omitempty"`
+	// Paths maps each ignored field, rendered like the keys of changes, to what
+	// ignored it: SuppressedByAnnotation or SuppressedByRule
+	Paths map[string]string `json:"paths,omitempty"`
+}
+
+const (
+	// SuppressedByAnnotation marks fields ignored by skiff.io/ignore-fields
+	SuppressedByAnnotation = "annotation"
+	// SuppressedByRule marks fields ignored by Options.Ignore
+	SuppressedByRule = "rule"
+)
+
+// Revisions records the git revisions of the before and after inputs
+type Revisions struct {
+	Before Revision `json:"before"`
+	After  Revision `json:"after"`
+}
+
+// Revision is a git revision as given and the commit it resolved to
+type Revision struct {
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
 }
 
 // ResourceChange represents a single resource change in Terraform style
@@ -19,12 +56,55 @@ type ResourceChange struct {
 	Namespace  string `json:"namespace"`
 	Name       string `json:"name"`
 	Change     Change `json:"change"`
+	// BeforeSource and AfterSource locate the object in the inputs, when known
+	BeforeSource *k8s.Source `json:"before_source,omitempty"`
+	AfterSource  *k8s.Source `json:"after_source,omitempty"`
 }
 
+// Action describes how a single field changed
+type Action string
+
+const (
+	// ActionAdd means the field is absent before and present after (possibly as null)
+	ActionAdd Action = "add"
+	// ActionRemove means the field is present before (possibly as null) and absent after
+	ActionRemove Action = "remove"
+	// ActionModify means the field is present on both sides with different values
+	ActionModify Action = "modify"
+	// ActionTypeChange means the field is present on both sides with values of
+	// different types, e.g. the string "1" and the number 1
+	ActionTypeChange Action = "type_change"
+)
+
 // FieldChange represents a change to a specific field
 type FieldChange struct {
-	From interface{} `json:"from"`
-	To   interface{} `json:"to"`
+	Action Action        `json:"action"`
+	From   interface{}   `json:"from"`
+	To     interface{}   `json:"to"`
+	Path   []interface{} `json:"path,omitempty"`
+	// FromLine and ToLine are the lines of the field in the before and after
+	// inputs, when known
+	FromLine int `json:"from_line,omitempty"`
+	ToLine   int `json:"to_line,omitempty"`
+	// FromCanonical and ToCanonical are the canonical forms of resource
+	// quantities (e.g. "0.5" becomes "500m"), set for quantity fields only
+	FromCanonical string `json:"from_canonical,omitempty"`
+	ToCanonical   string `json:"to_canonical,omitempty"`
+	// Sensitive is set when From and To were replaced by SensitiveValue
+	Sensitive bool `json:"sensitive,omitempty"`
+	// FromFingerprint and ToFingerprint are the HMAC-SHA256 of the hidden
+	// values of a sensitive change, set only with Options.FingerprintKey
+	FromFingerprint string `json:"from_fingerprint,omitempty"`
+	ToFingerprint   string `json:"to_fingerprint,omitempty"`
+	// TextDiff is a line diff of the two sides, set for changed data entries
+	// holding plain text with several lines and, with Options.TextDiffLines,
+	// for other long strings
+	TextDiff []Hunk `json:"text_diff,omitempty"`
+
+	path fieldPath
+	// entry is the data entry holding the config file the change was found
+	// in, if any; the fields of the file have no location of their own
+	entry fieldPath
 }
 
 // Change represents the before/after state and actions
@@ -33,13 +113,68 @@ type Change struct {
 	Before  map[string]interface{} `json:"before,omitempty"`
 	After   map[string]interface{} `json:"after,omitempty"`
 	Changes map[string]FieldChange `json:"changes,omitempty"`
+	// ReplacePaths lists changed fields that cannot be updated in place, which
+	// turns the update into a delete and create
+	ReplacePaths []string `json:"replace_paths,omitempty"`
+}
+
+// Options controls how objects are compared and how changes are rendered
+type Options struct {
+	// PathFormat selects how the keys of the changes map are rendered
+	PathFormat PathFormat
+	// IncludePath adds the structured path of each change as an array
+	IncludePath bool
+	// ConvertVersions converts an object that moved between known API versions
+	// to the newer version before comparing, so schema differences between the
+	// versions are not reported as changes
+	ConvertVersions bool
+	// ApplyDefaults compares objects with the defaults the API server would
+	// set filled in (see k8s.WithDefaults), so a field that one side leaves to
+	// its default is not reported as a change
+	ApplyDefaults bool
+	// Before and After locate objects and fields in the inputs, usually the
+	// *k8s.Manifest each side was parsed into. When set, resources and changes
+	// carry their source locations.
+	Before, After Locator
+	// TextDiffLines adds a line diff to every change between two strings when
+	// either side has at least this many lines; 0 turns it off
+	TextDiffLines int
+	// ShowSecrets turns off redaction: by default the values of Secret data
+	// are replaced by SensitiveValue in objects and changes
+	ShowSecrets bool
+	// Mask hides the values of matching fields like those of Secret data
+	Mask []MaskRule
+	// FingerprintKey keys the fingerprints of hidden values. Hidden values
+	// only get fingerprints when it is set, since without a secret key
+	// low-entropy values could be recovered from them by guessing.
+	FingerprintKey []byte
+	// Ignore suppresses changes to matching fields before actions are decided,
+	// so a resource whose only changes are ignored is reported as unchanged
+	Ignore []IgnoreRule
+}
+
+// DefaultOptions returns the options used by GenerateTerraformStyle
+func DefaultOptions() Options {
+	return Options{
+		PathFormat: PathFormatDot,
+	}
 }
 
 // GenerateTerraformStyle creates a flat diff format for easier policy writing
 func GenerateTerraformStyle(before, after map[string]map[string]interface{}) (*TerraformStyleResult, error) {
+	return GenerateTerraformStyleWithOptions(before, after, DefaultOptions())
+}
+
+// GenerateTerraformStyleWithOptions creates a flat diff format using the given options
+func GenerateTerraformStyleWithOptions(before, after map[string]map[string]interface{}, opts Options) (*TerraformStyleResult, error) {
 	result := &TerraformStyleResult{
 		ResourceChanges: make(map[string]ResourceChange),
 	}
+	ignoreRules := compileIgnoreRules(opts.Ignore)
+	maskRules, err := compileMaskRules(opts.Mask)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse all resource keys to extract metadata
 	allKeys := make(map[string]bool)
@@ -55,12 +190,29 @@ func GenerateTerraformStyle(before, after map[string]map[string]interface{}) (*T
 		beforeObj, beforeExists := before[key]
 		afterObj, afterExists := after[key]
 
-		// Extract resource metadata from key (apiVersion/kind/namespace/name)
-		apiVersion, kind, namespace, name := parseResourceKey(key)
+		// Extract resource metadata from key (group/kind/namespace/name)
+		_, kind, namespace, name := parseResourceKey(key)
+		apiVersion := objectAPIVersion(beforeObj, afterObj)
 
 		var change Change
 		var actions []string
 
+		// Secrets are compared as the API server stores them, with stringData
+		// merged into data, and data decoded
+		beforeObj = k8s.DecodeSecret(beforeObj)
+		afterObj = k8s.DecodeSecret(afterObj)
+		redact := !opts.ShowSecrets && (k8s.IsSecret(beforeObj) || k8s.IsSecret(afterObj))
+		masked := maskMatcher(kind, namespace, name, maskRules)
+
+		ignoreBefore, beforeFields := k8s.IgnoreDirectives(beforeObj)
+		ignoreAfter, afterFields := k8s.IgnoreDirectives(afterObj)
+		if ignoreBefore || ignoreAfter {
+			if !beforeExists || !afterExists || !cmp.Equal(beforeObj, afterObj) {
+				suppress(result, key, Suppression{Resource: true})
+			}
+			continue
+		}
+
 		if !beforeExists && afterExists {
 			// Resource was created
 			actions = []string{"create"}
@@ -77,64 +229,185 @@ func GenerateTerraformStyle(before, after map[string]map[string]interface{}) (*T
 			}
 		} else if beforeExists && afterExists {
 			// Resource might be updated
-			if !cmp.Equal(beforeObj, afterObj) {
-				actions = []string{"update"}
-				fieldChanges := generateFieldChanges(beforeObj, afterObj, "")
-				change = Change{
-					Actions: actions,
-					Before:  beforeObj,
-					After:   afterObj,
-					Changes: fieldChanges,
-				}
-			} else {
+			if cmp.Equal(beforeObj, afterObj) {
 				// No change, skip
 				continue
 			}
+
+			fieldChanges := compareObjects(beforeObj, afterObj, opts)
+			normalizeQuantities(kind, fieldChanges)
+			expandEmbedded(kind, fieldChanges)
+			suppressed := make(map[string]string)
+			if fields := append(beforeFields, afterFields...); len(fields) > 0 {
+				annotationRules := compileIgnoreRules([]IgnoreRule{{Paths: fields}})
+				for _, ignored := range ignoreChanges(kind, namespace, name, fieldChanges, annotationRules) {
+					suppressed[ignored.path.format(opts.PathFormat)] = SuppressedByAnnotation
+				}
+			}
+			for _, ignored := range ignoreChanges(kind, namespace, name, fieldChanges, ignoreRules) {
+				suppressed[ignored.path.format(opts.PathFormat)] = SuppressedByRule
+			}
+			if len(suppressed) > 0 {
+				suppress(result, key, Suppression{Paths: suppressed})
+			}
+			if len(fieldChanges) == 0 {
+				// Only ignored fields changed
+				continue
+			}
+
+			if opts.TextDiffLines > 0 {
+				addTextDiffs(fieldChanges, opts.TextDiffLines)
+			}
+			if redact {
+				redactChanges(fieldChanges, opts.FingerprintKey)
+			}
+			if masked != nil {
+				maskChanges(fieldChanges, masked, opts.FingerprintKey)
+			}
+			locateChanges(key, fieldChanges, opts)
+			replacePaths := findReplacePaths(kind, beforeObj, fieldChanges, opts)
+			if len(replacePaths) > 0 {
+				// Immutable fields changed, the resource has to be recreated
+				actions = []string{"delete", "create"}
+			} else {
+				actions = []string{"update"}
+			}
+			change = Change{
+				Actions:      actions,
+				Before:       beforeObj,
+				After:        afterObj,
+				Changes:      renderChanges(fieldChanges, opts),
+				ReplacePaths: replacePaths,
+			}
 		}
 
-		result.ResourceChanges[key] = ResourceChange{
+		if redact {
+			change.Before = redactSecret(change.Before)
+			change.After = redactSecret(change.After)
+		}
+		if masked != nil {
+			change.Before = maskObject(kind, change.Before, masked)
+			change.After = maskObject(kind, change.After, masked)
+		}
+
+		resourceChange := ResourceChange{
 			Type:       kind,
 			APIVersion: apiVersion,
 			Namespace:  namespace,
 			Name:       name,
 			Change:     change,
 		}
+		if beforeExists {
+			resourceChange.BeforeSource = locateObject(opts.Before, key)
+		}
+		if afterExists {
+			resourceChange.AfterSource = locateObject(opts.After, key)
+		}
+		result.ResourceChanges[key] = resourceChange
 	}
 
 	return result, nil
 }
 
-// parseResourceKey extracts metadata from resource key format: apiVersion/kind/namespace/name
-// Note: apiVersion may contain slashes (e.g., "autoscaling/v2")
-func parseResourceKey(key string) (apiVersion, kind, namespace, name string) {
+// suppress records what was left out of the diff for a resource
+func suppress(result *TerraformStyleResult, key string, suppression Suppression) {
+	if result.Suppressed == nil {
+		result.Suppressed = make(map[string]Suppression)
+	}
+	result.Suppressed[key] = suppression
+}
+
+// parseResourceKey extracts metadata from resource key format: group/kind/namespace/name
+func parseResourceKey(key string) (group, kind, namespace, name string) {
 	parts := strings.Split(key, "/")
-	if len(parts) >= 4 {
-		// Handle cases where apiVersion contains slashes
-		if len(parts) == 4 {
-			// Simple case: v1/Kind/namespace/name
-			apiVersion = parts[0]
-			kind = parts[1]
-			namespace = parts[2]
-			name = parts[3]
-		} else if len(parts) == 5 {
-			// Complex case: group/version/Kind/namespace/name
-			apiVersion = parts[0] + "/" + parts[1]
-			kind = parts[2]
-			namespace = parts[3]
-			name = parts[4]
-		}
+	if len(parts) == 4 {
+		group = parts[0]
+		kind = parts[1]
+		namespace = parts[2]
+		name = parts[3]
 	}
 	return
 }
 
+// objectAPIVersion returns the apiVersion of the newest version of an object
+func objectAPIVersion(before, after map[string]interface{}) string {
+	if apiVersion, ok := after["apiVersion"].(string); ok {
+		return apiVersion
+	}
+	apiVersion, _ := before["apiVersion"].(string)
+	return apiVersion
+}
+
+// compareObjects generates the field changes between two versions of an object.
+// With ConvertVersions, an object that moved to another API version is first
+// converted so only real changes are reported alongside the apiVersion change.
+func compareObjects(before, after map[string]interface{}, opts Options) map[string]FieldChange {
+	if opts.ApplyDefaults {
+		before = k8s.WithDefaults(before)
+		after = k8s.WithDefaults(after)
+	}
+
+	beforeVersion, _ := before["apiVersion"].(string)
+	afterVersion, _ := after["apiVersion"].(string)
+	if !opts.ConvertVersions || beforeVersion == afterVersion {
+		return generateFieldChanges(before, after, nil)
+	}
+
+	var changes map[string]FieldChange
+	if converted, ok := k8s.ConvertToVersion(before, afterVersion); ok {
+		changes = generateFieldChanges(converted, after, nil)
+	} else if converted, ok := k8s.ConvertToVersion(after, beforeVersion); ok {
+		changes = generateFieldChanges(before, converted, nil)
+	} else {
+		return generateFieldChanges(before, after, nil)
+	}
+
+	setChange(changes, modification(fieldPath(nil).child("apiVersion"), beforeVersion, afterVersion))
+	return changes
+}
+
 // isMapType checks if a value is a map[string]interface{}
 func isMapType(val interface{}) bool {
 	_, ok := val.(map[string]interface{})
 	return ok
 }
 
-// generateFieldChanges recursively compares two objects and generates flattened field changes
-func generateFieldChanges(before, after map[string]interface{}, prefix string) map[string]FieldChange {
+// renderChanges keys field changes by their path in the requested format. Bracket
+// paths and pointers are unique, but dot keys containing dots can render two
+// paths alike: a removal and an addition are then merged with mergeRemoveAdd,
+// and of any other changes that collide the first in bracket order keeps the
+// key and the others are keyed by their bracket path.
+func renderChanges(changes map[string]FieldChange, opts Options) map[string]FieldChange {
+	// changes is keyed by bracket path; go through it in order so collisions
+	// are resolved the same way on every run
+	paths := make([]string, 0, len(changes))
+	for path := range changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	rendered := make(map[string]FieldChange, len(changes))
+	for _, path := range paths {
+		change := changes[path]
+		if opts.IncludePath {
+			change.Path = change.path.elements()
+		}
+		key := change.path.format(opts.PathFormat)
+		if existing, exists := rendered[key]; exists {
+			if merged, ok := mergeRemoveAdd(existing, change); ok {
+				change = merged
+			} else {
+				key = path
+			}
+		}
+		rendered[key] = change
+	}
+	return rendered
+}
+
+// generateFieldChanges recursively compares two objects and generates flattened field changes.
+// Changes are keyed by their path in the bracket format, which is unambiguous.
+func generateFieldChanges(before, after map[string]interface{}, prefix fieldPath) map[string]FieldChange {
 	changes := make(map[string]FieldChange)
 
 	// Get all keys from both objects
@@ -147,20 +420,17 @@ func generateFieldChanges(before, after map[string]interface{}, prefix string) m
 	}
 
 	for key := range allKeys {
-		path := key
-		if prefix != "" {
-			path = prefix + "." + key
-		}
+		path := prefix.child(key)
 
 		beforeVal, beforeExists := before[key]
 		afterVal, afterExists := after[key]
 
 		if !beforeExists && afterExists {
 			// Field was added
-			flattenValue(changes, path, nil, afterVal)
+			flattenValue(changes, path, afterVal, ActionAdd)
 		} else if beforeExists && !afterExists {
 			// Field was removed
-			flattenValue(changes, path, beforeVal, nil)
+			flattenValue(changes, path, beforeVal, ActionRemove)
 		} else if beforeExists && afterExists {
 			// Field exists in both, check if changed
 			compareValues(changes, path, beforeVal, afterVal)
@@ -170,47 +440,105 @@ func generateFieldChanges(before, after map[string]interface{}, prefix string) m
 	return changes
 }
 
-// flattenValue adds all paths in a value to changes (for additions/deletions)
-func flattenValue(changes map[string]FieldChange, path string, from, to interface{}) {
-	if isMapType(to) {
+// flattenValue adds all paths in a value to changes, as additions or removals
+// depending on action. Empty maps and lists are recorded as a single change so
+// that adding `resources: {}` is not lost.
+func flattenValue(changes map[string]FieldChange, path fieldPath, value interface{}, action Action) {
+	if valueMap, ok := value.(map[string]interface{}); ok && len(valueMap) > 0 {
 		// If it's a map, recursively add all nested paths
-		toMap := to.(map[string]interface{})
-		for key, value := range toMap {
-			nestedPath := path + "." + key
-			flattenValue(changes, nestedPath, nil, value)
+		for key, nested := range valueMap {
+			flattenValue(changes, path.child(key), nested, action)
 		}
-	} else if isSliceType(to) {
-		// If it's a slice, add paths with indices
-		toSlice := to.([]interface{})
-		for i, value := range toSlice {
-			indexPath := path + "[" + fmt.Sprintf("%d", i) + "]"
-			flattenValue(changes, indexPath, nil, value)
+		return
+	}
+
+	if valueSlice, ok := value.([]interface{}); ok && len(valueSlice) > 0 {
+		// If it's a slice, add paths with indices or merge key selectors
+		// The list is only on one side, so its elements have the same index in
+		// both address spaces
+		key, _ := findMergeKey(path, valueSlice, nil)
+		for i, nested := range valueSlice {
+			after := i
+			if action == ActionRemove {
+				after = -1
+			}
+			flattenValue(changes, elementPath(path, key, i, after, nested), nested, action)
 		}
+		return
+	}
+
+	// Scalar value, null, or empty map/slice
+	if action == ActionRemove {
+		setChange(changes, FieldChange{Action: ActionRemove, From: value, path: path})
 	} else {
-		// Scalar value
-		changes[path] = FieldChange{From: from, To: to}
+		setChange(changes, FieldChange{Action: ActionAdd, To: value, path: path})
 	}
+}
 
-	// Also handle the case where from is not nil (deletions)
-	if isMapType(from) {
-		fromMap := from.(map[string]interface{})
-		for key, value := range fromMap {
-			nestedPath := path + "." + key
-			flattenValue(changes, nestedPath, value, nil)
-		}
-	} else if isSliceType(from) {
-		fromSlice := from.([]interface{})
-		for i, value := range fromSlice {
-			indexPath := path + "[" + fmt.Sprintf("%d", i) + "]"
-			flattenValue(changes, indexPath, value, nil)
-		}
-	} else if from != nil {
-		changes[path] = FieldChange{From: from, To: to}
+// setChange records a field change. A removal and an addition that land on the
+// same path (e.g. list elements removed and added at the same index) are merged
+// into a single change.
+func setChange(changes map[string]FieldChange, change FieldChange) {
+	key := change.path.bracket()
+	if existing, exists := changes[key]; exists {
+		change = mergeChanges(existing, change)
+	}
+	changes[key] = change
+}
+
+// mergeChanges combines two changes recorded for the same path. A removal and
+// an addition become a modification from the removed to the added value.
+func mergeChanges(existing, change FieldChange) FieldChange {
+	if merged, ok := mergeRemoveAdd(existing, change); ok {
+		return merged
+	}
+	return change
+}
+
+// mergeRemoveAdd turns a removal and an addition into a modification from the
+// removed to the added value
+func mergeRemoveAdd(existing, change FieldChange) (FieldChange, bool) {
+	switch {
+	case existing.Action == ActionRemove && change.Action == ActionAdd:
+		return modification(change.path, existing.From, change.To), true
+	case existing.Action == ActionAdd && change.Action == ActionRemove:
+		return modification(change.path, change.From, existing.To), true
+	default:
+		return FieldChange{}, false
+	}
+}
+
+// modification returns the change of a field present on both sides
+func modification(path fieldPath, from, to interface{}) FieldChange {
+	action := ActionModify
+	if from != nil && to != nil && valueType(from) != valueType(to) {
+		action = ActionTypeChange
+	}
+	return FieldChange{Action: action, From: from, To: to, path: path}
+}
+
+// valueType returns the JSON type of a decoded value
+func valueType(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", val)
 	}
 }
 
 // compareValues compares two values and adds changes if they differ
-func compareValues(changes map[string]FieldChange, path string, before, after interface{}) {
+func compareValues(changes map[string]FieldChange, path fieldPath, before, after interface{}) {
 	if cmp.Equal(before, after) {
 		return // No change
 	}
@@ -235,28 +563,153 @@ func compareValues(changes map[string]FieldChange, path string, before, after in
 	}
 
 	// Different types or scalar values - record the change
-	changes[path] = FieldChange{From: before, To: after}
+	setChange(changes, modification(path, before, after))
 }
 
-// compareSlices compares two slices element by element
-func compareSlices(changes map[string]FieldChange, path string, before, after []interface{}) {
-	maxLen := len(before)
-	if len(after) > maxLen {
-		maxLen = len(after)
-	}
+// listMergeKeys maps list field names to the Kubernetes merge keys that identify
+// their elements, in order of preference. The first key that is present and
+// unique on every element of both lists is used.
+var listMergeKeys = map[string][]string{
+	"containers":                {"name"},
+	"initContainers":            {"name"},
+	"ephemeralContainers":       {"name"},
+	"env":                       {"name"},
+	"ports":                     {"containerPort", "port"},
+	"volumes":                   {"name"},
+	"volumeMounts":              {"mountPath"},
+	"volumeDevices":             {"devicePath"},
+	"imagePullSecrets":          {"name"},
+	"hostAliases":               {"ip"},
+	"tolerations":               {"key"},
+	"topologySpreadConstraints": {"topologyKey"},
+	"resourceClaims":            {"name"},
+	"conditions":                {"type"},
+}
 
-	for i := 0; i < maxLen; i++ {
-		indexPath := path + "[" + fmt.Sprintf("%d", i) + "]"
+// compareSlices compares two slices, matching elements by merge key when the
+// list has one and by longest common subsequence otherwise
+func compareSlices(changes map[string]FieldChange, path fieldPath, before, after []interface{}) {
+	if key, ok := findMergeKey(path, before, after); ok {
+		compareKeyedSlices(changes, path, key, before, after)
+		return
+	}
+	compareUnkeyedSlices(changes, path, before, after)
+}
 
-		if i >= len(before) {
-			// Element added
-			flattenValue(changes, indexPath, nil, after[i])
-		} else if i >= len(after) {
+// compareUnkeyedSlices compares two slices without a merge key. Elements on the
+// longest common subsequence are unchanged; the runs between them are paired up
+// by position as modifications, and any left over are additions or removals.
+// Modified and removed elements are addressed by their index in before and
+// added ones by their index in after, marked as inserted.
+func compareUnkeyedSlices(changes map[string]FieldChange, path fieldPath, before, after []interface{}) {
+	matches := longestCommonSubsequence(len(before), len(after), func(i, j int) bool {
+		return cmp.Equal(before[i], after[j])
+	})
+	// Sentinel so the trailing run is handled like the others
+	matches = append(matches, match{len(before), len(after)})
+
+	i, j := 0, 0
+	for _, m := range matches {
+		for ; i < m.before && j < m.after; i, j = i+1, j+1 {
+			// Element replaced
+			compareValues(changes, elementPath(path, "", i, j, before[i], after[j]), before[i], after[j])
+		}
+		for ; i < m.before; i++ {
 			// Element removed
-			flattenValue(changes, indexPath, before[i], nil)
+			flattenValue(changes, elementPath(path, "", i, -1, before[i]), before[i], ActionRemove)
+		}
+		for ; j < m.after; j++ {
+			// Element added
+			flattenValue(changes, elementPath(path, "", -1, j, after[j]), after[j], ActionAdd)
+		}
+		i, j = m.before+1, m.after+1
+	}
+}
+
+// findMergeKey returns the merge key to match elements of the list at path, if
+// the field has known merge keys and one of them identifies every element
+func findMergeKey(path fieldPath, before, after []interface{}) (string, bool) {
+	for _, key := range listMergeKeys[path.field()] {
+		if isKeyedBy(before, key) && isKeyedBy(after, key) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// isKeyedBy checks that every element is a map with a unique scalar value for key
+func isKeyedBy(slice []interface{}, key string) bool {
+	seen := make(map[interface{}]bool)
+	for _, elem := range slice {
+		value, ok := mergeKeyValue(elem, key)
+		if !ok || seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+	return true
+}
+
+// mergeKeyValue returns an element's merge key value if it is a scalar
+func mergeKeyValue(elem interface{}, key string) (interface{}, bool) {
+	m, ok := elem.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	switch value := m[key].(type) {
+	case string, int, int64, float64, bool:
+		return value, true
+	default:
+		return nil, false
+	}
+}
+
+// elementPath returns the path of a list element, using a [key=value] selector when
+// the list has a merge key and the element index otherwise. before and after
+// are its indices as in fieldPath.element, and elems its versions, the first of
+// which holds the key.
+func elementPath(path fieldPath, key string, before, after int, elems ...interface{}) fieldPath {
+	var names []string
+	for _, elem := range elems {
+		if name, ok := mergeKeyValue(elem, "name"); ok {
+			names = append(names, fmt.Sprint(name))
+		}
+	}
+	if key != "" {
+		value, _ := mergeKeyValue(elems[0], key)
+		return path.element(before, after, key, value, names...)
+	}
+	return path.element(before, after, "", nil, names...)
+}
+
+// compareKeyedSlices compares two slices whose elements are identified by a merge key,
+// producing paths like containers[name=app].image. Keyed elements also record
+// their indices, which pointers address them by.
+func compareKeyedSlices(changes map[string]FieldChange, path fieldPath, key string, before, after []interface{}) {
+	afterIndex := make(map[interface{}]int)
+	for j, elem := range after {
+		value, _ := mergeKeyValue(elem, key)
+		afterIndex[value] = j
+	}
+
+	beforeIndex := make(map[interface{}]int)
+	for i, elem := range before {
+		value, _ := mergeKeyValue(elem, key)
+		beforeIndex[value] = i
+
+		if j, exists := afterIndex[value]; exists {
+			compareValues(changes, elementPath(path, key, i, j, elem, after[j]), elem, after[j])
 		} else {
-			// Element exists in both
-			compareValues(changes, indexPath, before[i], after[i])
+			// Element removed
+			flattenValue(changes, elementPath(path, key, i, -1, elem), elem, ActionRemove)
+		}
+	}
+
+	for j, elem := range after {
+		value, _ := mergeKeyValue(elem, key)
+		if _, exists := beforeIndex[value]; !exists {
+			// Element added
+			flattenValue(changes, elementPath(path, key, -1, j, elem), elem, ActionAdd)
 		}
 	}
 }
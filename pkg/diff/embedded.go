@@ -0,0 +1,251 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// embeddedFormat is the format of a config file held in a string value
+type embeddedFormat string
+
+const (
+	formatYAML       embeddedFormat = "yaml"
+	formatJSON       embeddedFormat = "json"
+	formatTOML       embeddedFormat = "toml"
+	formatProperties embeddedFormat = "properties"
+)
+
+// embeddedExtensions maps the extensions of data keys to the format of their values
+var embeddedExtensions = map[string]embeddedFormat{
+	".yaml":       formatYAML,
+	".yml":        formatYAML,
+	".json":       formatJSON,
+	".toml":       formatTOML,
+	".properties": formatProperties,
+}
+
+// isDataEntry checks whether a field is an entry of the data of a ConfigMap
+// or a decoded Secret (see k8s.DecodeSecret)
+func isDataEntry(kind string, path fieldPath) bool {
+	if len(path) != 2 || path[0].index >= 0 || path[1].index >= 0 {
+		return false
+	}
+	return (kind == "ConfigMap" || kind == "Secret") && path[0].key == "data"
+}
+
+// expandEmbedded replaces changes to data entries that hold config files with
+// changes to the fields of those files, nested below the entry, e.g.
+// data["application.yaml"].server.port. The format is taken from the extension
+// of the key (.yaml, .yml, .json, .toml, .properties); other keys are tried as
+// JSON and YAML and only count as config files if both sides are maps or
+// lists. An entry whose files are equal apart from formatting is dropped.
+// Changed entries of plain text with several lines get a line diff instead.
+func expandEmbedded(kind string, changes map[string]FieldChange) {
+	for key, change := range changes {
+		if !isDataEntry(kind, change.path) || change.Action != ActionModify {
+			continue
+		}
+		from, fromOK := change.From.(string)
+		to, toOK := change.To.(string)
+		if !fromOK || !toOK {
+			continue
+		}
+
+		if before, after, ok := parseEmbedded(change.path.field(), from, to); ok {
+			delete(changes, key)
+			nested := make(map[string]FieldChange)
+			compareValues(nested, change.path, before, after)
+			for _, nestedChange := range nested {
+				nestedChange.entry = change.path
+				setChange(changes, nestedChange)
+			}
+			continue
+		}
+
+		if isMultiline(from) || isMultiline(to) {
+			change.TextDiff = unifiedDiff(from, to)
+			changes[key] = change
+		}
+	}
+}
+
+// parseEmbedded parses both sides of a data entry as config files of the
+// format its name suggests
+func parseEmbedded(name, from, to string) (before, after interface{}, ok bool) {
+	formats := []embeddedFormat{formatJSON, formatYAML}
+	if format, known := embeddedExtensions[strings.ToLower(path.Ext(name))]; known {
+		formats = []embeddedFormat{format}
+	}
+
+	for _, format := range formats {
+		before, err := parseEmbeddedFile(format, from)
+		if err != nil || !isStructured(before) {
+			continue
+		}
+		after, err := parseEmbeddedFile(format, to)
+		if err != nil || isMapType(after) != isMapType(before) || !isStructured(after) {
+			continue
+		}
+		return before, after, true
+	}
+	return nil, nil, false
+}
+
+// isStructured checks whether a parsed value is a map or a list
+func isStructured(value interface{}) bool {
+	return isMapType(value) || isSliceType(value)
+}
+
+// parseEmbeddedFile parses a config file into the values objects are made of
+func parseEmbeddedFile(format embeddedFormat, data string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch format {
+	case formatJSON:
+		err = json.Unmarshal([]byte(data), &value)
+	case formatYAML:
+		err = yaml.Unmarshal([]byte(data), &value)
+	case formatTOML:
+		var table map[string]interface{}
+		_, err = toml.Decode(data, &table)
+		value = table
+	case formatProperties:
+		value, err = parseProperties(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalizeEmbedded(value), nil
+}
+
+// normalizeEmbedded converts the values decoders produce beyond those of
+// decoded objects: maps with non-string keys, lists of TOML tables, and dates
+func normalizeEmbedded(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = normalizeEmbedded(nested)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			m[fmt.Sprint(key)] = normalizeEmbedded(nested)
+		}
+		return m
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = normalizeEmbedded(nested)
+		}
+		return v
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, nested := range v {
+			list[i] = normalizeEmbedded(nested)
+		}
+		return list
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		// TOML local dates and times
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// parseProperties parses a Java properties file into a map of strings
+func parseProperties(data string) (map[string]interface{}, error) {
+	properties := make(map[string]interface{})
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		// A line ending in an odd number of backslashes continues on the next
+		for endsWithEscape(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+
+		end := 0
+		for end < len(line) && !strings.ContainsRune("=: \t\f", rune(line[end])) {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		end = min(end, len(line))
+		rest := strings.TrimLeft(line[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+
+		key, err := unescapeProperty(line[:end])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		value, err := unescapeProperty(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		properties[key] = value
+	}
+	return properties, nil
+}
+
+// endsWithEscape checks whether a line ends in an odd number of backslashes
+func endsWithEscape(line string) bool {
+	n := 0
+	for n < len(line) && line[len(line)-1-n] == '\\' {
+		n++
+	}
+	return n%2 == 1
+}
+
+// unescapeProperty resolves the escapes of a properties key or value
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid escape %q", s[i-1:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape %q", s[i-1:i+5])
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
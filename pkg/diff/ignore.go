@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IgnoreRule suppresses changes to fields of the resources it matches.
+// Kind, Namespace, Name, Paths and Value are globs in which "*" matches any
+// run of characters, including "." and "/"; an empty Kind, Namespace or Name
+// matches any resource.
+type IgnoreRule struct {
+	Kind      string `yaml:"kind,omitempty" json:"kind,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Name      string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Paths match field paths in the dot format, e.g.
+	// "metadata.annotations.checksum/*" or "spec.template.spec.containers[*].image".
+	// A path also matches every field below it.
+	Paths []string `yaml:"paths" json:"paths"`
+	// Value, if set, only ignores changes whose old and new values both match
+	// it (an absent side is not checked), e.g. "registry.example.com/*@sha256:*"
+	Value string `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// compiledRule is an IgnoreRule with its globs compiled
+type compiledRule struct {
+	kind, namespace, name *regexp.Regexp
+	paths                 []*regexp.Regexp
+	value                 *regexp.Regexp
+}
+
+// compileIgnoreRules compiles the globs of rules
+func compileIgnoreRules(rules []IgnoreRule) []compiledRule {
+	compiled := make([]compiledRule, len(rules))
+	for i, rule := range rules {
+		compiled[i] = compiledRule{
+			kind:      compileGlob(rule.Kind, ""),
+			namespace: compileGlob(rule.Namespace, ""),
+			name:      compileGlob(rule.Name, ""),
+			value:     compileGlob(rule.Value, ""),
+		}
+		for _, path := range rule.Paths {
+			// A path matches the field itself and everything below it
+			compiled[i].paths = append(compiled[i].paths, compileGlob(path, `(?:[.\[].*)?`))
+		}
+	}
+	return compiled
+}
+
+// compileGlob compiles a glob in which "*" matches any run of characters into
+// an anchored regexp, followed by suffix. An empty glob compiles to nil.
+func compileGlob(glob, suffix string) *regexp.Regexp {
+	if glob == "" {
+		return nil
+	}
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + suffix + "$")
+}
+
+// matchesResource checks whether the rule applies to a resource
+func (r compiledRule) matchesResource(kind, namespace, name string) bool {
+	return matchGlob(r.kind, kind) && matchGlob(r.namespace, namespace) && matchGlob(r.name, name)
+}
+
+// matchesChange checks whether the rule ignores a field change
+func (r compiledRule) matchesChange(change FieldChange) bool {
+	if r.value != nil {
+		for _, value := range []interface{}{change.From, change.To} {
+			if value != nil && !r.value.MatchString(fmt.Sprint(value)) {
+				return false
+			}
+		}
+	}
+
+	path := change.path.dot()
+	for _, glob := range r.paths {
+		if glob.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob checks a value against a compiled glob; a nil glob matches anything
+func matchGlob(glob *regexp.Regexp, value string) bool {
+	return glob == nil || glob.MatchString(value)
+}
+
+// ignoreChanges removes the changes of a resource that match any rule and
+// returns them
+func ignoreChanges(kind, namespace, name string, changes map[string]FieldChange, rules []compiledRule) []FieldChange {
+	var ignored []FieldChange
+	for _, rule := range rules {
+		if !rule.matchesResource(kind, namespace, name) {
+			continue
+		}
+		for key, change := range changes {
+			if rule.matchesChange(change) {
+				ignored = append(ignored, change)
+				delete(changes, key)
+			}
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,29 @@
+package diff
+
+import "testing"
+
+func TestIgnoreRulePaths(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    fieldPath
+		matches bool
+	}{
+		{"spec.replicas", fieldPath(nil).child("spec").child("replicas"), true},
+		{"spec.replica", fieldPath(nil).child("spec").child("replicas"), false},
+		{"spec", fieldPath(nil).child("spec").child("replicas"), true},
+		{"metadata.annotations.checksum/*", fieldPath(nil).child("metadata").child("annotations").child("checksum/config"), true},
+		{"metadata.annotations.checksum/*", fieldPath(nil).child("metadata").child("annotations").child("checksums"), false},
+		{"spec.containers[*].image", fieldPath(nil).child("spec").child("containers").element(0, 0, "name", "app").child("image"), true},
+		{"spec.containers", fieldPath(nil).child("spec").child("containers").element(1, 1, "", nil), true},
+		{"*.image", fieldPath(nil).child("spec").child("containers").element(0, 0, "name", "app").child("image"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.path.dot(), func(t *testing.T) {
+			rule := compileIgnoreRules([]IgnoreRule{{Paths: []string{tt.glob}}})[0]
+			if matches := rule.matchesChange(FieldChange{path: tt.path}); matches != tt.matches {
+				t.Errorf("expected %v, got %v", tt.matches, matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+)
+
+// immutableFields lists, per kind, the fields the API server refuses to update.
+// Changing any of them (or anything below them) forces the object to be
+// deleted and created again.
+var immutableFields = map[string][]string{
+	"Deployment":            {"spec.selector"},
+	"ReplicaSet":            {"spec.selector"},
+	"DaemonSet":             {"spec.selector"},
+	"StatefulSet":           {"spec.selector", "spec.serviceName", "spec.volumeClaimTemplates", "spec.podManagementPolicy"},
+	"Job":                   {"spec.selector", "spec.template", "spec.completionMode"},
+	"Service":               {"spec.clusterIP", "spec.clusterIPs"},
+	"PersistentVolumeClaim": {"spec.storageClassName", "spec.accessModes", "spec.volumeName", "spec.volumeMode", "spec.selector", "spec.dataSource"},
+	"StorageClass":          {"provisioner", "parameters", "reclaimPolicy", "volumeBindingMode"},
+	"RoleBinding":           {"roleRef"},
+	"ClusterRoleBinding":    {"roleRef"},
+}
+
+// immutableDataFields are frozen on ConfigMaps and Secrets marked `immutable: true`
+var immutableDataFields = []string{"immutable", "data", "binaryData", "stringData"}
+
+// findReplacePaths returns the immutable fields of an object that have changed,
+// rendered in the requested path format
+func findReplacePaths(kind string, before map[string]interface{}, changes map[string]FieldChange, opts Options) []string {
+	fields := immutableFields[kind]
+	if (kind == "ConfigMap" || kind == "Secret") && before["immutable"] == true {
+		fields = append(fields[:len(fields):len(fields)], immutableDataFields...)
+	}
+
+	var replacePaths []string
+	for _, field := range fields {
+		var immutable fieldPath
+		for _, key := range strings.Split(field, ".") {
+			immutable = immutable.child(key)
+		}
+
+		for _, change := range changes {
+			if change.path.hasPrefix(immutable) {
+				replacePaths = append(replacePaths, immutable.format(opts.PathFormat))
+				break
+			}
+		}
+	}
+
+	sort.Strings(replacePaths)
+	return replacePaths
+}
@@ -2,8 +2,12 @@ package diff
 
 import (
 	"os"
+	"sort"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
 	"skiff/pkg/k8s"
 )
 
@@ -223,3 +227,919 @@ func TestChangesField(t *testing.T) {
 		}
 	})
 }
+
+// diffTestCase parses the before/after pair for a test case and returns the diff
+func diffTestCase(t *testing.T, name string) *TerraformStyleResult {
+	t.Helper()
+	return diffTestCaseWithOptions(t, name, DefaultOptions())
+}
+
+// diffTestCaseWithOptions parses the before/after pair for a test case and returns
+// the diff generated with opts, locating changes in the parsed manifests
+func diffTestCaseWithOptions(t *testing.T, name string, opts Options) *TerraformStyleResult {
+	t.Helper()
+
+	beforeFile, err := os.Open("../../test/test-cases/" + name + "-before.yaml")
+	if err != nil {
+		t.Fatalf("failed to open before file: %v", err)
+	}
+	defer beforeFile.Close() // nolint
+
+	afterFile, err := os.Open("../../test/test-cases/" + name + "-after.yaml")
+	if err != nil {
+		t.Fatalf("failed to open after file: %v", err)
+	}
+	defer afterFile.Close() // nolint
+
+	beforeManifest, err := k8s.ParseManifest(beforeFile, k8s.ParseOptions{File: name + "-before.yaml"})
+	if err != nil {
+		t.Fatalf("failed to parse before YAML: %v", err)
+	}
+
+	afterManifest, err := k8s.ParseManifest(afterFile, k8s.ParseOptions{File: name + "-after.yaml"})
+	if err != nil {
+		t.Fatalf("failed to parse after YAML: %v", err)
+	}
+
+	opts.Before = beforeManifest
+	opts.After = afterManifest
+	result, err := GenerateTerraformStyleWithOptions(beforeManifest.Objects, afterManifest.Objects, opts)
+	if err != nil {
+		t.Fatalf("failed to generate diff: %v", err)
+	}
+	return result
+}
+
+func TestKeyedListChanges(t *testing.T) {
+	result := diffTestCase(t, "sidecar")
+
+	change, exists := result.ResourceChanges["apps/Deployment/default/web"]
+	if !exists {
+		t.Fatal("expected deployment change not found")
+	}
+
+	changes := change.Change.Changes
+	expected := map[string]FieldChange{
+		"spec.template.spec.containers[name=app].image":                                     {From: "nginx:1.20", To: "nginx:1.21"},
+		"spec.template.spec.containers[name=app].env[name=LOG_LEVEL].value":                 {From: "info", To: "debug"},
+		"spec.template.spec.containers[name=proxy].name":                                    {From: nil, To: "proxy"},
+		"spec.template.spec.containers[name=proxy].image":                                   {From: nil, To: "envoyproxy/envoy:v1.28"},
+		"spec.template.spec.containers[name=proxy].ports[containerPort=9901].containerPort": {From: nil, To: 9901},
+	}
+
+	if len(changes) != len(expected) {
+		t.Errorf("expected %d field changes, got %d: %v", len(expected), len(changes), changes)
+	}
+	for path, want := range expected {
+		got, exists := changes[path]
+		if !exists {
+			t.Errorf("expected change %s not found", path)
+			continue
+		}
+		if got.From != want.From || got.To != want.To {
+			t.Errorf("expected %s to change from %v to %v, got from %v to %v",
+				path, want.From, want.To, got.From, got.To)
+		}
+	}
+}
+
+func TestUnkeyedListChanges(t *testing.T) {
+	result := diffTestCase(t, "args")
+
+	change, exists := result.ResourceChanges["apps/Deployment/default/worker"]
+	if !exists {
+		t.Fatal("expected deployment change not found")
+	}
+
+	// Inserting --verbose must not cascade into the elements after it. Inserted
+	// elements are addressed by their index in after, the others by their index
+	// in before, so a replaced element and a removed one never share a path.
+	changes := change.Change.Changes
+	expected := map[string]FieldChange{
+		"metadata.finalizers[0]":                               {From: "example.com/cleanup", To: nil, FromLine: 7},
+		"spec.template.spec.containers[name=worker].args[+1]":  {From: nil, To: "--verbose", ToLine: 24},
+		"spec.template.spec.containers[name=worker].args[2]":   {From: "--log-format=json", To: "--log-format=text", FromLine: 26, ToLine: 26},
+		"spec.template.spec.containers[name=sidecar].args[+0]": {From: nil, To: "new", ToLine: 31},
+		"spec.template.spec.containers[name=sidecar].args[1]":  {From: "b", To: "c2", FromLine: 32, ToLine: 33},
+		"spec.template.spec.containers[name=sidecar].args[2]":  {From: "c", To: nil, FromLine: 33},
+	}
+
+	if len(changes) != len(expected) {
+		t.Errorf("expected %d field changes, got %d: %v", len(expected), len(changes), changes)
+	}
+	for path, want := range expected {
+		got, exists := changes[path]
+		if !exists {
+			t.Errorf("expected change %s not found", path)
+			continue
+		}
+		if got.From != want.From || got.To != want.To {
+			t.Errorf("expected %s to change from %v to %v, got from %v to %v",
+				path, want.From, want.To, got.From, got.To)
+		}
+		if got.FromLine != want.FromLine || got.ToLine != want.ToLine {
+			t.Errorf("expected %s on lines %d and %d, got %d and %d",
+				path, want.FromLine, want.ToLine, got.FromLine, got.ToLine)
+		}
+	}
+}
+
+func TestPathFormats(t *testing.T) {
+	tests := []struct {
+		format   PathFormat
+		expected []string
+	}{
+		{
+			format: PathFormatDot,
+			expected: []string{
+				"metadata.labels.app.kubernetes.io/version",
+				"spec.template.spec.containers[name=api].image",
+			},
+		},
+		{
+			format: PathFormatBracket,
+			expected: []string{
+				`metadata.labels["app.kubernetes.io/version"]`,
+				`spec.template.spec.containers[name="api"].image`,
+			},
+		},
+		{
+			format: PathFormatPointer,
+			expected: []string{
+				"/metadata/labels/app.kubernetes.io~1version",
+				"/spec/template/spec/containers/0/image",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.PathFormat = tt.format
+			opts.IncludePath = true
+			result := diffTestCaseWithOptions(t, "labels", opts)
+
+			changes := result.ResourceChanges["apps/Deployment/default/api"].Change.Changes
+			if len(changes) != len(tt.expected) {
+				t.Errorf("expected %d field changes, got %d: %v", len(tt.expected), len(changes), changes)
+			}
+			for _, path := range tt.expected {
+				if _, exists := changes[path]; !exists {
+					t.Errorf("expected change %s not found", path)
+				}
+			}
+
+			label := changes[tt.expected[0]]
+			expectedPath := []interface{}{"metadata", "labels", "app.kubernetes.io/version"}
+			if !cmp.Equal(label.Path, expectedPath) {
+				t.Errorf("expected structured path %v, got %v", expectedPath, label.Path)
+			}
+		})
+	}
+}
+
+func TestPointerCollisions(t *testing.T) {
+	container := func(name, image string) interface{} {
+		return map[string]interface{}{"name": name, "image": image}
+	}
+	pod := func(containers ...interface{}) map[string]map[string]interface{} {
+		return map[string]map[string]interface{}{
+			"core/Pod/default/app": {
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": "app", "namespace": "default"},
+				"spec":       map[string]interface{}{"containers": containers},
+			},
+		}
+	}
+	before := pod(container("x", "img1"), container("a", "img2"))
+	after := pod(container("b", "img0"), container("a", "img3"))
+
+	// Containers in before are addressed by their index there and the inserted
+	// one by its index in after with a +, so no two changes share a pointer
+	expected := map[string]FieldChange{
+		"/spec/containers/0/image":  {Action: ActionRemove, From: "img1"},
+		"/spec/containers/0/name":   {Action: ActionRemove, From: "x"},
+		"/spec/containers/1/image":  {Action: ActionModify, From: "img2", To: "img3"},
+		"/spec/containers/+0/image": {Action: ActionAdd, To: "img0"},
+		"/spec/containers/+0/name":  {Action: ActionAdd, To: "b"},
+	}
+
+	opts := DefaultOptions()
+	opts.PathFormat = PathFormatPointer
+	for i := 0; i < 10; i++ {
+		result, err := GenerateTerraformStyleWithOptions(before, after, opts)
+		if err != nil {
+			t.Fatalf("failed to generate diff: %v", err)
+		}
+		changes := result.ResourceChanges["core/Pod/default/app"].Change.Changes
+		if diff := cmp.Diff(expected, changes, cmpopts.IgnoreUnexported(FieldChange{})); diff != "" {
+			t.Fatalf("unexpected changes (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestFieldChangeActions(t *testing.T) {
+	result := diffTestCase(t, "nulls")
+
+	tests := []struct {
+		key    string
+		path   string
+		action Action
+		from   interface{}
+		to     interface{}
+	}{
+		{
+			key:    "apps/Deployment/default/app",
+			path:   "spec.paused",
+			action: ActionRemove,
+			from:   nil,
+			to:     nil,
+		},
+		{
+			key:    "apps/Deployment/default/app",
+			path:   "spec.template.spec.containers[name=app].resources",
+			action: ActionModify,
+			from:   nil,
+			to:     map[string]interface{}{"limits": map[string]interface{}{"cpu": "500m"}},
+		},
+		{
+			key:    "apps/Deployment/default/app",
+			path:   "spec.template.spec.containers[name=sidecar].resources.limits.cpu",
+			action: ActionAdd,
+			from:   nil,
+			to:     "100m",
+		},
+		{
+			key:    "apps/Deployment/default/app",
+			path:   "spec.template.spec.containers[name=sidecar].securityContext",
+			action: ActionAdd,
+			from:   nil,
+			to:     map[string]interface{}{},
+		},
+		{
+			key:    "example.com/Widget/default/widget",
+			path:   "spec.size",
+			action: ActionTypeChange,
+			from:   "1",
+			to:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			change, exists := result.ResourceChanges[tt.key].Change.Changes[tt.path]
+			if !exists {
+				t.Fatalf("expected change %s not found", tt.path)
+			}
+			if change.Action != tt.action {
+				t.Errorf("expected action %s, got %s", tt.action, change.Action)
+			}
+			if !cmp.Equal(change.From, tt.from) || !cmp.Equal(change.To, tt.to) {
+				t.Errorf("expected change from %v to %v, got from %v to %v",
+					tt.from, tt.to, change.From, change.To)
+			}
+		})
+	}
+}
+
+func TestReplaceActions(t *testing.T) {
+	result := diffTestCase(t, "immutable")
+
+	tests := []struct {
+		key          string
+		actions      []string
+		replacePaths []string
+	}{
+		{
+			key:          "apps/Deployment/default/web",
+			actions:      []string{"delete", "create"},
+			replacePaths: []string{"spec.selector"},
+		},
+		{
+			key:          "core/ConfigMap/default/settings",
+			actions:      []string{"delete", "create"},
+			replacePaths: []string{"data"},
+		},
+		{
+			key:     "core/Service/default/web",
+			actions: []string{"update"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			change, exists := result.ResourceChanges[tt.key]
+			if !exists {
+				t.Fatalf("expected change %s not found", tt.key)
+			}
+			if !cmp.Equal(change.Change.Actions, tt.actions) {
+				t.Errorf("expected actions %v, got %v", tt.actions, change.Change.Actions)
+			}
+			if !cmp.Equal(change.Change.ReplacePaths, tt.replacePaths) {
+				t.Errorf("expected replace paths %v, got %v", tt.replacePaths, change.Change.ReplacePaths)
+			}
+			if change.Change.Before == nil || change.Change.After == nil {
+				t.Error("expected both before and after objects")
+			}
+		})
+	}
+}
+
+func TestAPIVersionMigration(t *testing.T) {
+	tests := []struct {
+		name            string
+		convertVersions bool
+		key             string
+		apiVersion      string
+		changeCount     int
+	}{
+		{
+			name:        "same schema",
+			key:         "autoscaling/HorizontalPodAutoscaler/default/web",
+			apiVersion:  "autoscaling/v2",
+			changeCount: 1,
+		},
+		{
+			name:        "group moved without conversion",
+			key:         "networking.k8s.io/Ingress/default/web",
+			apiVersion:  "networking.k8s.io/v1",
+			changeCount: 6,
+		},
+		{
+			name:            "group moved with conversion",
+			convertVersions: true,
+			key:             "networking.k8s.io/Ingress/default/web",
+			apiVersion:      "networking.k8s.io/v1",
+			changeCount:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.ConvertVersions = tt.convertVersions
+			result := diffTestCaseWithOptions(t, "api-migration", opts)
+
+			if len(result.ResourceChanges) != 2 {
+				t.Errorf("expected 2 resource changes, got %d", len(result.ResourceChanges))
+			}
+
+			change, exists := result.ResourceChanges[tt.key]
+			if !exists {
+				t.Fatalf("expected change %s not found", tt.key)
+			}
+			if !cmp.Equal(change.Change.Actions, []string{"update"}) {
+				t.Errorf("expected update action, got %v", change.Change.Actions)
+			}
+			if change.APIVersion != tt.apiVersion {
+				t.Errorf("expected apiVersion %s, got %s", tt.apiVersion, change.APIVersion)
+			}
+
+			changes := change.Change.Changes
+			if len(changes) != tt.changeCount {
+				t.Errorf("expected %d field changes, got %d: %v", tt.changeCount, len(changes), changes)
+			}
+			if changes["apiVersion"].Action != ActionModify {
+				t.Errorf("expected apiVersion change, got %v", changes["apiVersion"])
+			}
+		})
+	}
+}
+
+func TestSourceLocations(t *testing.T) {
+	result := diffTestCase(t, "mixed-changes")
+
+	tests := []struct {
+		key          string
+		beforeSource *k8s.Source
+		afterSource  *k8s.Source
+		path         string
+		fromLine     int
+		toLine       int
+	}{
+		{
+			key:          "apps/Deployment/default/changed-app",
+			beforeSource: &k8s.Source{File: "mixed-changes-before.yaml", Document: 3, Line: 17, Column: 1},
+			afterSource:  &k8s.Source{File: "mixed-changes-after.yaml", Document: 3, Line: 17, Column: 1},
+			path:         "spec.replicas",
+			fromLine:     23,
+			toLine:       23,
+		},
+		{
+			key:          "core/ConfigMap/default/old-config",
+			beforeSource: &k8s.Source{File: "mixed-changes-before.yaml", Document: 2, Line: 9, Column: 1},
+		},
+		{
+			key:         "core/ConfigMap/default/new-config",
+			afterSource: &k8s.Source{File: "mixed-changes-after.yaml", Document: 2, Line: 9, Column: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			change, exists := result.ResourceChanges[tt.key]
+			if !exists {
+				t.Fatalf("expected change %s not found", tt.key)
+			}
+			if !cmp.Equal(change.BeforeSource, tt.beforeSource) {
+				t.Errorf("expected before source %v, got %v", tt.beforeSource, change.BeforeSource)
+			}
+			if !cmp.Equal(change.AfterSource, tt.afterSource) {
+				t.Errorf("expected after source %v, got %v", tt.afterSource, change.AfterSource)
+			}
+			if tt.path == "" {
+				return
+			}
+
+			fieldChange := change.Change.Changes[tt.path]
+			if fieldChange.FromLine != tt.fromLine || fieldChange.ToLine != tt.toLine {
+				t.Errorf("expected %s on lines %d and %d, got %d and %d",
+					tt.path, tt.fromLine, tt.toLine, fieldChange.FromLine, fieldChange.ToLine)
+			}
+		})
+	}
+}
+
+func TestServerFields(t *testing.T) {
+	result := diffTestCase(t, "noisy")
+
+	change, exists := result.ResourceChanges["core/ConfigMap/default/noisy-config"]
+	if !exists {
+		t.Fatalf("expected change for noisy-config not found")
+	}
+
+	if len(change.Change.Changes) != 1 {
+		t.Errorf("expected only data.key to change, got %v", change.Change.Changes)
+	}
+	fieldChange, exists := change.Change.Changes["data.key"]
+	if !exists || fieldChange.From != "value" || fieldChange.To != "updated-value" {
+		t.Errorf("expected data.key to change from value to updated-value, got %v", fieldChange)
+	}
+	if _, ok := change.Change.After["status"]; ok {
+		t.Errorf("expected status to be stripped, got %v", change.Change.After)
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Ignore = []IgnoreRule{
+		{Kind: "Deployment", Namespace: "*", Paths: []string{"metadata.annotations.checksum/*", "spec.template.metadata.annotations"}},
+		{Paths: []string{"metadata.labels.helm.sh/chart"}},
+		{Kind: "Deployment", Paths: []string{"spec.template.spec.containers[*].image"}, Value: "registry.example.com/*@sha256:*"},
+	}
+	result := diffTestCaseWithOptions(t, "helm-noise", opts)
+
+	if _, exists := result.ResourceChanges["core/ConfigMap/default/web-config"]; exists {
+		t.Errorf("expected the ConfigMap with only ignored changes to be unchanged")
+	}
+
+	change, exists := result.ResourceChanges["apps/Deployment/default/web"]
+	if !exists {
+		t.Fatalf("expected change for the Deployment not found")
+	}
+
+	var paths []string
+	for path := range change.Change.Changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	expected := []string{"spec.replicas", "spec.template.spec.containers[name=proxy].image"}
+	if !cmp.Equal(paths, expected) {
+		t.Errorf("expected changes %v, got %v", expected, paths)
+	}
+}
+
+func TestIgnoreAnnotations(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Ignore = []IgnoreRule{{Kind: "Deployment", Paths: []string{"spec.template.spec.containers[*].image"}, Value: "api:*"}}
+	result := diffTestCaseWithOptions(t, "ignore-annotations", opts)
+
+	for _, key := range []string{"core/ConfigMap/default/generated", "core/Secret/default/scratch", "core/ConfigMap/default/static"} {
+		if _, exists := result.ResourceChanges[key]; exists {
+			t.Errorf("expected %s to be skipped by %s", key, k8s.IgnoreAnnotation)
+		}
+	}
+
+	change, exists := result.ResourceChanges["apps/Deployment/default/api"]
+	if !exists {
+		t.Fatalf("expected change for the Deployment not found")
+	}
+	// Removing the annotation itself is still reported
+	if len(change.Change.Changes) != 1 {
+		t.Errorf("expected only the annotation change, got %v", change.Change.Changes)
+	}
+	if _, exists := change.Change.Changes["metadata.annotations.skiff.io/ignore-fields"]; !exists {
+		t.Errorf("expected the removed annotation to be reported, got %v", change.Change.Changes)
+	}
+
+	expected := map[string]Suppression{
+		"apps/Deployment/default/api": {Paths: map[string]string{
+			"spec.replicas": SuppressedByAnnotation,
+			"spec.template.metadata.annotations.kubectl.kubernetes.io/restartedAt": SuppressedByAnnotation,
+			"spec.template.spec.containers[name=api].image":                        SuppressedByRule,
+		}},
+		"core/ConfigMap/default/generated": {Resource: true},
+		"core/Secret/default/scratch":      {Resource: true},
+	}
+	if diff := cmp.Diff(expected, result.Suppressed); diff != "" {
+		t.Errorf("unexpected suppressed section (-want +got):\n%s", diff)
+	}
+}
+
+func TestQuantityChanges(t *testing.T) {
+	result := diffTestCase(t, "quantities")
+
+	for _, key := range []string{"core/PersistentVolumeClaim/default/data", "core/LimitRange/default/defaults"} {
+		if change, exists := result.ResourceChanges[key]; exists {
+			t.Errorf("expected %s with only equal quantities to be unchanged, got %v", key, change.Change.Changes)
+		}
+	}
+
+	tests := []struct {
+		key       string
+		path      string
+		from, to  interface{}
+		canonical [2]string
+	}{
+		{
+			key:       "apps/Deployment/default/worker",
+			path:      "spec.template.spec.containers[name=worker].resources.limits.cpu",
+			from:      1,
+			to:        "1500m",
+			canonical: [2]string{"1", "1500m"},
+		},
+		{
+			key:       "core/ResourceQuota/default/quota",
+			path:      "spec.hard.requests.memory",
+			from:      "8Gi",
+			to:        "16Gi",
+			canonical: [2]string{"8Gi", "16Gi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			changes := result.ResourceChanges[tt.key].Change.Changes
+			if len(changes) != 1 {
+				t.Errorf("expected only %s to change, got %v", tt.path, changes)
+			}
+			change, exists := changes[tt.path]
+			if !exists {
+				t.Fatalf("expected change %s not found", tt.path)
+			}
+			if change.Action != ActionModify {
+				t.Errorf("expected action %s, got %s", ActionModify, change.Action)
+			}
+			if !cmp.Equal(change.From, tt.from) || !cmp.Equal(change.To, tt.to) {
+				t.Errorf("expected raw change from %v to %v, got from %v to %v", tt.from, tt.to, change.From, change.To)
+			}
+			if change.FromCanonical != tt.canonical[0] || change.ToCanonical != tt.canonical[1] {
+				t.Errorf("expected canonical change from %s to %s, got from %s to %s",
+					tt.canonical[0], tt.canonical[1], change.FromCanonical, change.ToCanonical)
+			}
+		})
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	opts := DefaultOptions()
+	opts.ApplyDefaults = true
+	result := diffTestCaseWithOptions(t, "defaults", opts)
+
+	if change, exists := result.ResourceChanges["apps/Deployment/default/api"]; exists {
+		t.Errorf("expected the Deployment that only spells out defaults to be unchanged, got %v", change.Change.Changes)
+	}
+
+	change, exists := result.ResourceChanges["core/Service/default/api"]
+	if !exists {
+		t.Fatalf("expected change for the Service not found")
+	}
+	expected := map[string]FieldChange{
+		"spec.ports[port=80].protocol": {Action: ActionModify, From: "TCP", To: "UDP", ToLine: 45},
+	}
+	if diff := cmp.Diff(expected, change.Change.Changes, cmpopts.IgnoreUnexported(FieldChange{})); diff != "" {
+		t.Errorf("unexpected changes (-want +got):\n%s", diff)
+	}
+
+	// Without defaulting every spelled-out default is a change
+	result = diffTestCase(t, "defaults")
+	if _, exists := result.ResourceChanges["apps/Deployment/default/api"]; !exists {
+		t.Errorf("expected the Deployment to change without defaulting")
+	}
+}
+
+func TestEmbeddedFiles(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PathFormat = PathFormatBracket
+	result := diffTestCaseWithOptions(t, "embedded", opts)
+
+	change, exists := result.ResourceChanges["core/ConfigMap/default/app-config"]
+	if !exists {
+		t.Fatalf("expected change for the ConfigMap not found")
+	}
+	expected := map[string]FieldChange{
+		`data["application.yaml"].server.port`:     {Action: ActionModify, From: 8080, To: 9090, FromLine: 7, ToLine: 7},
+		`data["application.yaml"].features[+2]`:    {Action: ActionAdd, To: "audit", ToLine: 7},
+		`data["config.json"].logging.level`:        {Action: ActionModify, From: "info", To: "debug", FromLine: 12, ToLine: 12},
+		`data["app.toml"].database.pool`:           {Action: ActionModify, From: int64(10), To: int64(20), FromLine: 15, ToLine: 19},
+		`data["app.properties"]["jdbc.pool.size"]`: {Action: ActionModify, From: "10", To: "20", FromLine: 20, ToLine: 24},
+		`data.settings.mode`:                       {Action: ActionModify, From: "fast", To: "safe", FromLine: 24, ToLine: 28},
+		`data["nginx.conf"]`: {
+			Action:   ActionModify,
+			From:     "server {\n  listen 80;\n  location / {\n    proxy_pass http://app:8080;\n  }\n  gzip on;\n}\n",
+			To:       "server {\n  listen 80;\n  location / {\n    proxy_pass http://app:9090;\n  }\n  gzip on;\n}\n",
+			FromLine: 25,
+			ToLine:   29,
+			TextDiff: []Hunk{{
+				FromLine:  1,
+				FromCount: 7,
+				ToLine:    1,
+				ToCount:   7,
+				Lines: []string{
+					" server {",
+					"   listen 80;",
+					"   location / {",
+					"-    proxy_pass http://app:8080;",
+					"+    proxy_pass http://app:9090;",
+					"   }",
+					"   gzip on;",
+					" }",
+				},
+			}},
+		},
+	}
+	if diff := cmp.Diff(expected, change.Change.Changes, cmpopts.IgnoreUnexported(FieldChange{})); diff != "" {
+		t.Errorf("unexpected changes (-want +got):\n%s", diff)
+	}
+
+	change, exists = result.ResourceChanges["core/Secret/default/db"]
+	if !exists {
+		t.Fatalf("expected change for the Secret not found")
+	}
+	if _, exists := change.Change.Changes[`data["config.yaml"].endpoint`]; !exists || len(change.Change.Changes) != 1 {
+		t.Errorf("expected only the decoded endpoint to change, got %v", change.Change.Changes)
+	}
+}
+
+func TestEmbeddedFilesDotFormat(t *testing.T) {
+	result := diffTestCase(t, "embedded")
+
+	changes := result.ResourceChanges["core/ConfigMap/default/app-config"].Change.Changes
+	// The dot format cannot tell the data key from the fields of the file
+	for _, path := range []string{"data.application.yaml.server.port", "data.app.properties.jdbc.pool.size", "data.settings.mode"} {
+		if _, exists := changes[path]; !exists {
+			t.Errorf("expected change %s not found, got %v", path, changes)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		expected []Hunk
+	}{
+		{
+			name: "separate hunks",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:   "1\nb\n3\n4\n5\n6\n7\n8\n9\n10\n11\nl\n",
+			expected: []Hunk{
+				{FromLine: 1, FromCount: 5, ToLine: 1, ToCount: 5, Lines: []string{" 1", "-2", "+b", " 3", " 4", " 5"}},
+				{FromLine: 9, FromCount: 4, ToLine: 9, ToCount: 4, Lines: []string{" 9", " 10", " 11", "-12", "+l"}},
+			},
+		},
+		{
+			name: "insertion",
+			from: "a\nb\n",
+			to:   "a\nx\nb\n",
+			expected: []Hunk{
+				{FromLine: 1, FromCount: 2, ToLine: 1, ToCount: 3, Lines: []string{" a", "+x", " b"}},
+			},
+		},
+		{
+			name: "from empty",
+			from: "",
+			to:   "a\n",
+			expected: []Hunk{
+				{FromLine: 0, FromCount: 0, ToLine: 1, ToCount: 1, Lines: []string{"+a"}},
+			},
+		},
+		{
+			name: "missing final newline",
+			from: "a\nb",
+			to:   "a\nb\n",
+			expected: []Hunk{
+				{FromLine: 1, FromCount: 2, ToLine: 1, ToCount: 2, Lines: []string{" a", "-b", "+b"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.expected, unifiedDiff(tt.from, tt.to)); diff != "" {
+				t.Errorf("unexpected hunks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTextDiffLines(t *testing.T) {
+	opts := DefaultOptions()
+	opts.TextDiffLines = 5
+	result := diffTestCaseWithOptions(t, "scripts", opts)
+
+	changes := result.ResourceChanges["batch/Job/default/migrate"].Change.Changes
+	script, exists := changes["spec.template.spec.containers[name=migrate].command[2]"]
+	if !exists {
+		t.Fatalf("expected change to the script not found, got %v", changes)
+	}
+	expected := []Hunk{{
+		FromLine:  1,
+		FromCount: 10,
+		ToLine:    1,
+		ToCount:   10,
+		Lines: []string{
+			" set -e",
+			` echo "waiting for database"`,
+			" until pg_isready -h db; do",
+			"-  sleep 2",
+			"+  sleep 5",
+			" done",
+			` echo "running migrations"`,
+			` migrate -path /migrations -database "$DATABASE_URL" up`,
+			` echo "seeding"`,
+			"-seed --env staging",
+			"+seed --env production",
+			` echo "done"`,
+		},
+	}}
+	if diff := cmp.Diff(expected, script.TextDiff); diff != "" {
+		t.Errorf("unexpected text diff (-want +got):\n%s", diff)
+	}
+
+	// The two-line annotation is below the threshold
+	if note := changes["metadata.annotations.note"]; note.TextDiff != nil {
+		t.Errorf("expected no text diff for a short string, got %v", note.TextDiff)
+	}
+
+	// Off by default
+	result = diffTestCase(t, "scripts")
+	for path, change := range result.ResourceChanges["batch/Job/default/migrate"].Change.Changes {
+		if change.TextDiff != nil {
+			t.Errorf("expected no text diff by default, got one for %s", path)
+		}
+	}
+}
+
+func TestSecretRedaction(t *testing.T) {
+	result := diffTestCase(t, "secrets")
+
+	if change, exists := result.ResourceChanges["core/Secret/default/reencoded"]; exists {
+		t.Errorf("expected the Secret that only moved a value to stringData to be unchanged, got %v", change.Change.Changes)
+	}
+
+	change, exists := result.ResourceChanges["core/Secret/default/app"]
+	if !exists {
+		t.Fatalf("expected change for the Secret not found")
+	}
+	expected := map[string]FieldChange{
+		"data.token":                {Action: ActionModify, From: SensitiveValue, To: SensitiveValue, Sensitive: true, FromLine: 9, ToLine: 8},
+		"data.api-key":              {Action: ActionAdd, To: SensitiveValue, Sensitive: true},
+		"data.config.yaml.endpoint": {Action: ActionModify, From: SensitiveValue, To: SensitiveValue, Sensitive: true, FromLine: 10, ToLine: 9},
+	}
+	// Without a fingerprint key there are no fingerprints, which would be plain
+	// hashes of the values
+	if diff := cmp.Diff(expected, change.Change.Changes, cmpopts.IgnoreUnexported(FieldChange{})); diff != "" {
+		t.Errorf("unexpected changes (-want +got):\n%s", diff)
+	}
+
+	expectedData := map[string]interface{}{"password": SensitiveValue, "token": SensitiveValue, "config.yaml": SensitiveValue, "api-key": SensitiveValue}
+	if diff := cmp.Diff(expectedData, change.Change.After["data"]); diff != "" {
+		t.Errorf("unexpected data after (-want +got):\n%s", diff)
+	}
+	if _, exists := change.Change.After["stringData"]; exists {
+		t.Errorf("expected stringData to be merged into data")
+	}
+
+	opts := DefaultOptions()
+	opts.FingerprintKey = []byte("test")
+	result = diffTestCaseWithOptions(t, "secrets", opts)
+	token := result.ResourceChanges["core/Secret/default/app"].Change.Changes["data.token"]
+	if token.FromFingerprint != fingerprint("old-token", opts.FingerprintKey) || token.ToFingerprint != fingerprint("new-token", opts.FingerprintKey) {
+		t.Errorf("expected fingerprints of the token with a key, got %+v", token)
+	}
+
+	opts = DefaultOptions()
+	opts.ShowSecrets = true
+	result = diffTestCaseWithOptions(t, "secrets", opts)
+	changes := result.ResourceChanges["core/Secret/default/app"].Change.Changes
+	if token := changes["data.token"]; token.From != "old-token" || token.To != "new-token" || token.Sensitive {
+		t.Errorf("expected the decoded token to change from old-token to new-token, got %+v", token)
+	}
+}
+
+func TestMaskRules(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Mask = []MaskRule{
+		{Paths: []string{"*.env[*].value"}, Keys: "(?i)password|token"},
+		{Kind: "ConfigMap", Paths: []string{"data"}, Keys: "(?i)url"},
+		{Kind: "PostgresCluster", Paths: []string{"spec.credentials"}},
+		// Element names only hide the values of name/value entries
+		{Name: "worker", Keys: "(?i)password|token"},
+	}
+	opts.FingerprintKey = []byte("test")
+	result := diffTestCaseWithOptions(t, "masking", opts)
+
+	hunter2 := fingerprint("hunter2", opts.FingerprintKey)
+	horse := fingerprint("correct-horse", opts.FingerprintKey)
+	masked := FieldChange{Action: ActionModify, From: SensitiveValue, To: SensitiveValue, Sensitive: true, FromFingerprint: hunter2, ToFingerprint: horse}
+
+	tests := []struct {
+		key      string
+		expected map[string]FieldChange
+	}{
+		{
+			key: "apps/Deployment/default/api",
+			expected: map[string]FieldChange{
+				"spec.template.spec.containers[name=api].env[name=DB_PASSWORD].value": masked,
+				"spec.template.spec.containers[name=api].env[name=LOG_LEVEL].value":   {Action: ActionModify, From: "info", To: "debug"},
+			},
+		},
+		{
+			// Duplicate env names fall back to index matching
+			key: "apps/Deployment/default/worker",
+			expected: map[string]FieldChange{
+				"spec.template.spec.containers[name=worker].env[0].value":   masked,
+				"spec.template.spec.containers[name=worker].env[1].value":   {Action: ActionModify, From: "info", To: "debug"},
+				"spec.template.spec.containers[name=token-refresher].image": {Action: ActionModify, From: "token-refresher:1.0", To: "token-refresher:1.1"},
+			},
+		},
+		{
+			key: "db.example.com/PostgresCluster/default/main",
+			expected: map[string]FieldChange{
+				"spec.credentials.password": masked,
+			},
+		},
+	}
+
+	ignoreLines := cmpopts.IgnoreFields(FieldChange{}, "FromLine", "ToLine")
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			changes := result.ResourceChanges[tt.key].Change.Changes
+			if diff := cmp.Diff(tt.expected, changes, cmpopts.IgnoreUnexported(FieldChange{}), ignoreLines); diff != "" {
+				t.Errorf("unexpected changes (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	configMap := result.ResourceChanges["core/ConfigMap/default/api"].Change
+	for _, path := range []string{"data.DATABASE_URL", "data.app.yaml.db.url"} {
+		if change := configMap.Changes[path]; change.To != SensitiveValue || change.ToFingerprint == "" {
+			t.Errorf("expected %s to be masked, got %+v", path, change)
+		}
+	}
+	// The config file is hidden as a whole since one of its fields is masked
+	expectedData := map[string]interface{}{"DATABASE_URL": SensitiveValue, "app.yaml": SensitiveValue}
+	if diff := cmp.Diff(expectedData, configMap.After["data"]); diff != "" {
+		t.Errorf("unexpected data after (-want +got):\n%s", diff)
+	}
+
+	deployment := result.ResourceChanges["apps/Deployment/default/api"].Change
+	containers := deployment.Before["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	expectedEnv := []interface{}{
+		map[string]interface{}{"name": "DB_PASSWORD", "value": SensitiveValue},
+		map[string]interface{}{"name": "LOG_LEVEL", "value": "info"},
+	}
+	if diff := cmp.Diff(expectedEnv, containers[0].(map[string]interface{})["env"]); diff != "" {
+		t.Errorf("unexpected env before (-want +got):\n%s", diff)
+	}
+
+	worker := result.ResourceChanges["apps/Deployment/default/worker"].Change
+	containers = worker.After["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	expectedEnv = []interface{}{
+		map[string]interface{}{"name": "DB_PASSWORD", "value": SensitiveValue},
+		map[string]interface{}{"name": "LOG", "value": "debug"},
+		map[string]interface{}{"name": "LOG", "value": "json"},
+	}
+	if diff := cmp.Diff(expectedEnv, containers[0].(map[string]interface{})["env"]); diff != "" {
+		t.Errorf("unexpected worker env after (-want +got):\n%s", diff)
+	}
+	expectedContainer := map[string]interface{}{"name": "token-refresher", "image": "token-refresher:1.1"}
+	if diff := cmp.Diff(expectedContainer, containers[1]); diff != "" {
+		t.Errorf("unexpected token-refresher container after (-want +got):\n%s", diff)
+	}
+
+	// Fingerprints depend on the key
+	if other := fingerprint("hunter2", []byte("other")); other == hunter2 {
+		t.Errorf("expected fingerprints with different keys to differ")
+	}
+}
+
+func TestMaskRulesInvalidKeys(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Mask = []MaskRule{{Keys: "(password"}}
+	if _, err := GenerateTerraformStyleWithOptions(nil, nil, opts); err == nil {
+		t.Errorf("expected an error for invalid keys")
+	}
+}
@@ -0,0 +1,77 @@
+package diff
+
+// maxLCSCells bounds the size of the LCS table; larger inputs are matched by position
+const maxLCSCells = 4_000_000
+
+// match pairs an index in the before sequence with an index in the after sequence
+type match struct {
+	before, after int
+}
+
+// longestCommonSubsequence returns the index pairs of a longest common subsequence
+// of two sequences of length n and m, in increasing order. Common leading and
+// trailing elements are matched directly so the table only covers the region
+// that actually changed.
+func longestCommonSubsequence(n, m int, equal func(i, j int) bool) []match {
+	var prefix []match
+	for len(prefix) < n && len(prefix) < m && equal(len(prefix), len(prefix)) {
+		prefix = append(prefix, match{len(prefix), len(prefix)})
+	}
+	start := len(prefix)
+
+	var suffix []match
+	for n-len(suffix) > start && m-len(suffix) > start && equal(n-len(suffix)-1, m-len(suffix)-1) {
+		suffix = append(suffix, match{n - len(suffix) - 1, m - len(suffix) - 1})
+	}
+
+	rows, cols := n-start-len(suffix), m-start-len(suffix)
+	var middle []match
+	if rows > 0 && cols > 0 && rows*cols <= maxLCSCells {
+		middle = lcsTable(rows, cols, func(i, j int) bool { return equal(start+i, start+j) })
+		for k := range middle {
+			middle[k].before += start
+			middle[k].after += start
+		}
+	}
+
+	result := append(prefix, middle...)
+	for k := len(suffix) - 1; k >= 0; k-- {
+		result = append(result, suffix[k])
+	}
+	return result
+}
+
+// lcsTable computes a longest common subsequence with the classic dynamic programming table
+func lcsTable(n, m int, equal func(i, j int) bool) []match {
+	// lengths[i][j] is the LCS length of before[i:] and after[j:]
+	lengths := make([][]int, n+1)
+	for i := range lengths {
+		lengths[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if equal(i, j) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	var matches []match
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case equal(i, j):
+			matches = append(matches, match{i, j})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
@@ -0,0 +1,51 @@
+package diff
+
+import (
+	"skiff/pkg/k8s"
+)
+
+// Locator finds where objects and their fields were read from.
+// *k8s.Manifest implements it.
+type Locator interface {
+	// Locate returns the source of a field of the object with the given key.
+	// The path uses the elements of FieldChange.Path; an empty path locates
+	// the object itself.
+	Locate(key string, path []interface{}) (k8s.Source, bool)
+}
+
+// locateObject returns the source of an object, or nil if it cannot be located
+func locateObject(locator Locator, key string) *k8s.Source {
+	if locator == nil {
+		return nil
+	}
+	source, ok := locator.Locate(key, nil)
+	if !ok {
+		return nil
+	}
+	return &source
+}
+
+// locateChanges adds the line of each changed field on both sides
+func locateChanges(key string, changes map[string]FieldChange, opts Options) {
+	if opts.Before == nil && opts.After == nil {
+		return
+	}
+
+	for path, change := range changes {
+		located := change.path
+		if change.entry != nil {
+			located = change.entry
+		}
+		if opts.Before != nil && change.Action != ActionAdd {
+			if source, ok := opts.Before.Locate(key, located.elementsIn(false)); ok {
+				change.FromLine = source.Line
+			}
+		}
+		if opts.After != nil && change.Action != ActionRemove {
+			if source, ok := opts.After.Locate(key, located.elementsIn(true)); ok {
+				change.ToLine = source.Line
+			}
+		}
+		changes[path] = change
+	}
+}
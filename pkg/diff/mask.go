@@ -0,0 +1,220 @@
+package diff
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// MaskRule hides the values of fields of the resources it matches, like the
+// values of Secret data. Kind, Namespace, Name and Paths are globs as in
+// IgnoreRule; an empty Paths matches every field.
+type MaskRule struct {
+	Kind      string   `yaml:"kind,omitempty" json:"kind,omitempty"`
+	Namespace string   `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Name      string   `yaml:"name,omitempty" json:"name,omitempty"`
+	Paths     []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+	// Keys, if set, is a regexp that one of the names of a field must match:
+	// its last map key or, for the value or valueFrom of a name/value list
+	// entry, the entry's name. "(?i)password" matches both
+	// spec.credentials.password and env[name=DB_PASSWORD].value, and env[0].value
+	// when that entry is named DB_PASSWORD. Fields below a masked field are
+	// masked too.
+	Keys string `yaml:"keys,omitempty" json:"keys,omitempty"`
+}
+
+// compiledMask is a MaskRule with its globs and regexp compiled
+type compiledMask struct {
+	compiledRule
+	keys *regexp.Regexp
+}
+
+// compileMaskRules compiles the globs and regexps of rules
+func compileMaskRules(rules []MaskRule) ([]compiledMask, error) {
+	compiled := make([]compiledMask, len(rules))
+	for i, rule := range rules {
+		ignore := compileIgnoreRules([]IgnoreRule{{Kind: rule.Kind, Namespace: rule.Namespace, Name: rule.Name, Paths: rule.Paths}})
+		compiled[i].compiledRule = ignore[0]
+		if rule.Keys != "" {
+			keys, err := regexp.Compile(rule.Keys)
+			if err != nil {
+				return nil, fmt.Errorf("mask rule %d: invalid keys: %w", i+1, err)
+			}
+			compiled[i].keys = keys
+		}
+	}
+	return compiled, nil
+}
+
+// matchesPath checks whether the rule masks a field
+func (r compiledMask) matchesPath(path fieldPath) bool {
+	if len(r.paths) > 0 {
+		dot := path.dot()
+		matched := false
+		for _, glob := range r.paths {
+			if glob.MatchString(dot) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if r.keys == nil {
+		return true
+	}
+	for _, name := range fieldNames(path) {
+		if r.keys.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueFields are the fields holding the value of a name/value list entry
+// such as an env var
+var valueFields = map[string]bool{"value": true, "valueFrom": true}
+
+// fieldNames returns the names a field goes by: its last map key and, for the
+// value of a name/value list entry, the name of the entry, however the entry
+// is addressed. Other fields of list elements, including the name itself, go
+// by their key only, so a container named after a secret keeps its image.
+func fieldNames(path fieldPath) []string {
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].index >= 0 {
+			continue
+		}
+		names := []string{path[i].key}
+		if i == len(path)-1 && i > 0 && path[i-1].index >= 0 && valueFields[path[i].key] {
+			names = append(names, path[i-1].names...)
+		}
+		return names
+	}
+	return nil
+}
+
+// maskMatcher returns a function checking whether any rule masks a field of
+// the given resource or a field it is part of, or nil if no rule applies to
+// the resource
+func maskMatcher(kind, namespace, name string, rules []compiledMask) func(fieldPath) bool {
+	var applicable []compiledMask
+	for _, rule := range rules {
+		if rule.matchesResource(kind, namespace, name) {
+			applicable = append(applicable, rule)
+		}
+	}
+	if len(applicable) == 0 {
+		return nil
+	}
+	return func(path fieldPath) bool {
+		for _, rule := range applicable {
+			for n := 1; n <= len(path); n++ {
+				if rule.matchesPath(path[:n]) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// maskChanges hides the values of the changes to masked fields that are not
+// hidden yet
+func maskChanges(changes map[string]FieldChange, masked func(fieldPath) bool, key []byte) {
+	for path, change := range changes {
+		if !change.Sensitive && masked(change.path) {
+			changes[path] = redactChange(change, key)
+		}
+	}
+}
+
+// maskObject returns a copy of an object with the values of masked fields
+// replaced by SensitiveValue. A data entry holding a config file (see
+// expandEmbedded) is replaced as a whole if any field of the file is masked.
+func maskObject(kind string, obj map[string]interface{}, masked func(fieldPath) bool) map[string]interface{} {
+	if obj == nil {
+		return nil
+	}
+	return maskValue(kind, obj, nil, masked).(map[string]interface{})
+}
+
+// maskValue returns a copy of a value below path with masked fields replaced
+func maskValue(kind string, value interface{}, path fieldPath, masked func(fieldPath) bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			child := path.child(key)
+			if masked(child) || isDataEntry(kind, child) && containsMaskedFile(key, nested, child, masked) {
+				copied[key] = SensitiveValue
+			} else {
+				copied[key] = maskValue(kind, nested, child, masked)
+			}
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		key, _ := findMergeKey(path, v, nil)
+		for i, nested := range v {
+			element := elementPath(path, key, i, i, nested)
+			if masked(element) {
+				copied[i] = SensitiveValue
+			} else {
+				copied[i] = maskValue(kind, nested, element, masked)
+			}
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// containsMaskedFile checks whether a data entry holds a config file with a
+// masked field
+func containsMaskedFile(name string, value interface{}, path fieldPath, masked func(fieldPath) bool) bool {
+	data, ok := value.(string)
+	if !ok {
+		return false
+	}
+	parsed, _, ok := parseEmbedded(name, data, data)
+	return ok && containsMasked(parsed, path, masked)
+}
+
+// containsMasked checks whether a value below path has a masked field
+func containsMasked(value interface{}, path fieldPath, masked func(fieldPath) bool) bool {
+	if masked(path) {
+		return true
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			if containsMasked(nested, path.child(key), masked) {
+				return true
+			}
+		}
+	case []interface{}:
+		key, _ := findMergeKey(path, v, nil)
+		for i, nested := range v {
+			if containsMasked(nested, elementPath(path, key, i, i, nested), masked) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fingerprint returns the hex HMAC-SHA256 of the JSON encoding of a value, so
+// policies can tell whether a hidden value changed without seeing it
+func fingerprint(value interface{}, key []byte) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded = []byte(fmt.Sprint(value))
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(encoded) // nolint:errcheck // never fails
+	return hex.EncodeToString(mac.Sum(nil))
+}
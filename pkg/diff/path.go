@@ -0,0 +1,342 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PathFormat selects how field paths are rendered as keys of the changes map
+type PathFormat string
+
+const (
+	// PathFormatDot joins keys with "." (e.g. metadata.labels.app.kubernetes.io/name).
+	// This is the default, but keys containing dots make it ambiguous.
+	PathFormatDot PathFormat = "dot"
+	// PathFormatBracket quotes keys that are not plain identifiers
+	// (e.g. metadata.labels["app.kubernetes.io/name"]); see ParsePath
+	PathFormatBracket PathFormat = "bracket"
+	// PathFormatPointer renders RFC 6901 JSON Pointers (e.g. /metadata/labels/app.kubernetes.io~1name).
+	// List elements are always addressed by index, inserted ones as +index.
+	PathFormatPointer PathFormat = "pointer"
+)
+
+// ParsePathFormat validates a path format name
+func ParsePathFormat(name string) (PathFormat, error) {
+	switch format := PathFormat(name); format {
+	case PathFormatDot, PathFormatBracket, PathFormatPointer:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown path format %q (expected dot, bracket or pointer)", name)
+	}
+}
+
+// pathSegment is one step of a field path: a map key, a list index, or a list
+// element selected by merge key. List elements are addressed by their index in
+// before, or by their index in after when they were inserted, so the changes
+// to one list never share a path.
+type pathSegment struct {
+	key   string      // map key
+	index int         // list index, or -1 for a map key
+	added bool        // index is in after, as the element was inserted
+	after int         // index of a list element in after, or -1 if it is not there
+	match string      // merge key of a keyed list element
+	value interface{} // merge key value of a keyed list element
+	names []string    // values of the name field of a list element, for mask rules
+}
+
+// fieldPath is the structured path of a field within an object
+type fieldPath []pathSegment
+
+// plainKey matches map keys that need no quoting in the bracket format
+var plainKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// child returns the path of a map key below p
+func (p fieldPath) child(key string) fieldPath {
+	return append(p[:len(p):len(p)], pathSegment{key: key, index: -1})
+}
+
+// element returns the path of a list element below p, selected by merge key when
+// match is set. before and after are the element's indices in each list, -1 on
+// the side it is missing from. names are the element's name fields.
+func (p fieldPath) element(before, after int, match string, value interface{}, names ...string) fieldPath {
+	seg := pathSegment{index: before, after: after, match: match, value: value, names: names}
+	if before < 0 {
+		seg.index, seg.added = after, true
+	}
+	return append(p[:len(p):len(p)], seg)
+}
+
+// field returns the map key p ends with, or "" if it ends with a list element
+func (p fieldPath) field() string {
+	if len(p) == 0 || p[len(p)-1].index >= 0 {
+		return ""
+	}
+	return p[len(p)-1].key
+}
+
+// hasPrefix checks whether p starts with all segments of prefix
+func (p fieldPath) hasPrefix(prefix fieldPath) bool {
+	if len(p) < len(prefix) {
+		return false
+	}
+	for i, seg := range prefix {
+		if p[i].index != seg.index || p[i].added != seg.added || p[i].key != seg.key ||
+			p[i].match != seg.match || p[i].value != seg.value {
+			return false
+		}
+	}
+	return true
+}
+
+// format renders the path in the given format
+func (p fieldPath) format(format PathFormat) string {
+	switch format {
+	case PathFormatBracket:
+		return p.bracket()
+	case PathFormatPointer:
+		return p.pointer()
+	default:
+		return p.dot()
+	}
+}
+
+// dot renders the path with keys joined by "." and [index], [+index] (inserted)
+// or [key=value] elements
+func (p fieldPath) dot() string {
+	var b strings.Builder
+	for i, seg := range p {
+		switch {
+		case seg.index < 0:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(seg.key)
+		case seg.match != "":
+			fmt.Fprintf(&b, "[%s=%v]", seg.match, seg.value)
+		default:
+			fmt.Fprintf(&b, "[%s]", seg.indexString())
+		}
+	}
+	return b.String()
+}
+
+// indexString renders the index of a list element, with a + if it is in after
+func (seg pathSegment) indexString() string {
+	if seg.added {
+		return "+" + strconv.Itoa(seg.index)
+	}
+	return strconv.Itoa(seg.index)
+}
+
+// bracket renders the path like dot, but quotes keys and selector values that
+// could otherwise be misread
+func (p fieldPath) bracket() string {
+	var b strings.Builder
+	for i, seg := range p {
+		switch {
+		case seg.index < 0 && plainKey.MatchString(seg.key):
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(seg.key)
+		case seg.index < 0:
+			fmt.Fprintf(&b, "[%s]", strconv.Quote(seg.key))
+		case seg.match != "":
+			if s, ok := seg.value.(string); ok {
+				fmt.Fprintf(&b, "[%s=%s]", seg.match, strconv.Quote(s))
+			} else {
+				fmt.Fprintf(&b, "[%s=%v]", seg.match, seg.value)
+			}
+		default:
+			fmt.Fprintf(&b, "[%s]", seg.indexString())
+		}
+	}
+	return b.String()
+}
+
+// pointer renders the path as an RFC 6901 JSON Pointer. An inserted element is
+// written as +index, its index in after, so it cannot share a pointer with an
+// element addressed by its index in before.
+func (p fieldPath) pointer() string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	var b strings.Builder
+	for _, seg := range p {
+		b.WriteByte('/')
+		if seg.index < 0 {
+			b.WriteString(escaper.Replace(seg.key))
+		} else {
+			b.WriteString(seg.indexString())
+		}
+	}
+	return b.String()
+}
+
+// elements returns the path as an array of map keys (strings), list indices
+// (ints) and merge key selectors (single-entry objects). Indices are in before,
+// except for inserted elements.
+func (p fieldPath) elements() []interface{} {
+	elements := make([]interface{}, len(p))
+	for i, seg := range p {
+		switch {
+		case seg.index < 0:
+			elements[i] = seg.key
+		case seg.match != "":
+			elements[i] = map[string]interface{}{seg.match: seg.value}
+		default:
+			elements[i] = seg.index
+		}
+	}
+	return elements
+}
+
+// elementsIn returns the elements of the path within after, or before if after
+// is false: list elements are addressed by their index in that list
+func (p fieldPath) elementsIn(after bool) []interface{} {
+	elements := p.elements()
+	if !after {
+		return elements
+	}
+	for i, seg := range p {
+		if seg.index >= 0 && seg.match == "" {
+			elements[i] = seg.after
+		}
+	}
+	return elements
+}
+
+// ParsePath parses a path in the bracket format into the same array of elements
+// that is emitted as the structured path of a change: map keys as strings, list
+// indices as ints and merge key selectors as single-entry maps.
+//
+// The grammar is:
+//
+//	path     = segment { [ "." ] segment }
+//	segment  = key | "[" ( quoted | index | selector ) "]"
+//	index    = [ "+" ] 1*DIGIT
+//	key      = 1*( ALPHA | DIGIT | "_" | "-" )
+//	selector = key "=" ( quoted | number | "true" | "false" )
+//
+// where quoted is a double-quoted Go/JSON string. The index of an inserted
+// element, written with a +, is its index in after.
+func ParsePath(path string) ([]interface{}, error) {
+	var elements []interface{}
+	for pos := 0; pos < len(path); {
+		if len(elements) > 0 && path[pos] == '.' {
+			pos++
+		}
+
+		if pos < len(path) && path[pos] != '[' {
+			end := pos
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			key := path[pos:end]
+			if !plainKey.MatchString(key) {
+				return nil, fmt.Errorf("invalid key %q at offset %d", key, pos)
+			}
+			elements = append(elements, key)
+			pos = end
+			continue
+		}
+
+		if pos >= len(path) {
+			return nil, fmt.Errorf("unexpected end of path after offset %d", pos-1)
+		}
+
+		element, end, err := parseBracket(path, pos)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		pos = end
+	}
+	return elements, nil
+}
+
+// parseBracket parses a [...] segment starting at pos, returning the element and
+// the offset just past the closing bracket
+func parseBracket(path string, pos int) (interface{}, int, error) {
+	inner := pos + 1
+	if inner < len(path) && path[inner] == '"' {
+		key, end, err := parseQuoted(path, inner)
+		if err != nil {
+			return nil, 0, err
+		}
+		if end >= len(path) || path[end] != ']' {
+			return nil, 0, fmt.Errorf("expected ] at offset %d", end)
+		}
+		return key, end + 1, nil
+	}
+
+	eq := strings.IndexAny(path[inner:], "=]")
+	if eq < 0 {
+		return nil, 0, fmt.Errorf("unterminated [ at offset %d", pos)
+	}
+	eq += inner
+
+	if path[eq] == ']' {
+		index, err := strconv.Atoi(path[inner:eq])
+		if err != nil || index < 0 {
+			return nil, 0, fmt.Errorf("invalid index %q at offset %d", path[inner:eq], inner)
+		}
+		return index, eq + 1, nil
+	}
+
+	match := path[inner:eq]
+	if !plainKey.MatchString(match) {
+		return nil, 0, fmt.Errorf("invalid selector key %q at offset %d", match, inner)
+	}
+
+	var value interface{}
+	end := eq + 1
+	if end < len(path) && path[end] == '"' {
+		s, next, err := parseQuoted(path, end)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, end = s, next
+	} else {
+		close := strings.IndexByte(path[end:], ']')
+		if close < 0 {
+			return nil, 0, fmt.Errorf("unterminated [ at offset %d", pos)
+		}
+		literal := path[end : end+close]
+		if i, err := strconv.Atoi(literal); err == nil {
+			value = i
+		} else if f, err := strconv.ParseFloat(literal, 64); err == nil {
+			value = f
+		} else if b, err := strconv.ParseBool(literal); err == nil {
+			value = b
+		} else {
+			return nil, 0, fmt.Errorf("invalid selector value %q at offset %d", literal, end)
+		}
+		end += close
+	}
+
+	if end >= len(path) || path[end] != ']' {
+		return nil, 0, fmt.Errorf("expected ] at offset %d", end)
+	}
+	return map[string]interface{}{match: value}, end + 1, nil
+}
+
+// parseQuoted parses a double-quoted string starting at pos, returning the
+// unquoted string and the offset just past the closing quote
+func parseQuoted(path string, pos int) (string, int, error) {
+	end := pos + 1
+	for end < len(path) && path[end] != '"' {
+		if path[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(path) {
+		return "", 0, fmt.Errorf("unterminated string at offset %d", pos)
+	}
+	s, err := strconv.Unquote(path[pos : end+1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid string at offset %d: %w", pos, err)
+	}
+	return s, end + 1, nil
+}
@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected []interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "plain keys",
+			path:     "spec.replicas",
+			expected: []interface{}{"spec", "replicas"},
+		},
+		{
+			name:     "quoted key",
+			path:     `metadata.labels["app.kubernetes.io/name"]`,
+			expected: []interface{}{"metadata", "labels", "app.kubernetes.io/name"},
+		},
+		{
+			name:     "index",
+			path:     "spec.behavior.scaleUp.policies[0].value",
+			expected: []interface{}{"spec", "behavior", "scaleUp", "policies", 0, "value"},
+		},
+		{
+			name: "selectors",
+			path: `spec.containers[name="app"].ports[containerPort=8080].protocol`,
+			expected: []interface{}{
+				"spec", "containers", map[string]interface{}{"name": "app"},
+				"ports", map[string]interface{}{"containerPort": 8080}, "protocol",
+			},
+		},
+		{
+			name:     "quoted key with escapes",
+			path:     `data["say \"hi\"]"].x`,
+			expected: []interface{}{"data", `say "hi"]`, "x"},
+		},
+		{
+			name:    "unquoted dotted key",
+			path:    "metadata.labels.app.kubernetes.io/name",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated bracket",
+			path:    "spec.containers[0",
+			wantErr: true,
+		},
+		{
+			name:    "empty key",
+			path:    "spec..replicas",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			elements, err := ParsePath(tt.path)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if !cmp.Equal(elements, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, elements)
+			}
+		})
+	}
+}
+
+func TestParsePathRoundTrip(t *testing.T) {
+	path := fieldPath(nil).child("metadata").child("annotations").child("checksum/config").
+		child("x").element(2, 2, "name", "a.b]\"c").child("0")
+
+	elements, err := ParsePath(path.bracket())
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", path.bracket(), err)
+	}
+	if !cmp.Equal(elements, path.elements()) {
+		t.Errorf("expected %v, got %v", path.elements(), elements)
+	}
+}
@@ -0,0 +1,86 @@
+package diff
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// quantityMaps lists fields that map resource names to quantities, e.g.
+// resources.requests in containers, PVCs and ResourceQuota spec.hard
+var quantityMaps = map[string]bool{
+	"requests":    true,
+	"limits":      true,
+	"capacity":    true,
+	"allocatable": true,
+	"hard":        true,
+	"used":        true,
+	"overhead":    true,
+}
+
+// limitRangeQuantityMaps lists the quantity maps of LimitRange spec.limits items
+var limitRangeQuantityMaps = map[string]bool{
+	"max":                  true,
+	"min":                  true,
+	"default":              true,
+	"defaultRequest":       true,
+	"maxLimitRequestRatio": true,
+}
+
+// quantityFields lists fields that hold a single quantity
+var quantityFields = map[string]bool{
+	"sizeLimit": true, // emptyDir
+}
+
+// isQuantityPath checks whether a field of an object of the given kind holds
+// a resource quantity
+func isQuantityPath(kind string, path fieldPath) bool {
+	if quantityFields[path.field()] {
+		return true
+	}
+	if len(path) < 2 || path.field() == "" {
+		return false
+	}
+	parent := path[:len(path)-1].field()
+	return quantityMaps[parent] || (kind == "LimitRange" && limitRangeQuantityMaps[parent])
+}
+
+// parseQuantity parses a YAML scalar as a quantity
+func parseQuantity(value interface{}) (resource.Quantity, bool) {
+	switch value.(type) {
+	case string, int, int64, float64:
+		quantity, err := resource.ParseQuantity(fmt.Sprint(value))
+		return quantity, err == nil
+	default:
+		return resource.Quantity{}, false
+	}
+}
+
+// normalizeQuantities compares quantity fields by value: changes between
+// equal quantities such as "0.5" and "500m" are dropped, and the remaining
+// changes carry the canonical form of each side. A number and a string are
+// both valid quantities, so such a change is a modify, not a type_change.
+func normalizeQuantities(kind string, changes map[string]FieldChange) {
+	for key, change := range changes {
+		if !isQuantityPath(kind, change.path) {
+			continue
+		}
+
+		from, fromOK := parseQuantity(change.From)
+		to, toOK := parseQuantity(change.To)
+		if fromOK && toOK {
+			if from.Cmp(to) == 0 {
+				delete(changes, key)
+				continue
+			}
+			change.Action = ActionModify
+		}
+		if fromOK {
+			change.FromCanonical = from.String()
+		}
+		if toOK {
+			change.ToCanonical = to.String()
+		}
+		changes[key] = change
+	}
+}
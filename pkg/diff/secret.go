@@ -0,0 +1,87 @@
+package diff
+
+import "skiff/pkg/k8s"
+
+// SensitiveValue replaces redacted values, as in Terraform plans
+const SensitiveValue = "(sensitive value)"
+
+// isSecretPath checks whether a field of a decoded Secret holds secret data:
+// an entry of data, or the last-applied-configuration annotation that copies it
+func isSecretPath(path fieldPath) bool {
+	if len(path) > 0 && path[0].index < 0 && path[0].key == "data" {
+		return true
+	}
+	return len(path) == 3 && path[0].key == "metadata" && path[1].key == "annotations" &&
+		path[2].key == k8s.LastAppliedAnnotation
+}
+
+// redactChanges hides the values of changes to secret data and marks them
+// sensitive. Absent values stay null so the action still reads correctly.
+func redactChanges(changes map[string]FieldChange, key []byte) {
+	for path, change := range changes {
+		if !isSecretPath(change.path) {
+			continue
+		}
+		changes[path] = redactChange(change, key)
+	}
+}
+
+// redactChange replaces the values of a change by SensitiveValue and marks it
+// sensitive. With a key, the values are kept as fingerprints; without one a
+// fingerprint would be a plain hash of the value, so there is none.
+func redactChange(change FieldChange, key []byte) FieldChange {
+	if change.From != nil {
+		if len(key) > 0 {
+			change.FromFingerprint = fingerprint(change.From, key)
+		}
+		change.From = SensitiveValue
+	}
+	if change.To != nil {
+		if len(key) > 0 {
+			change.ToFingerprint = fingerprint(change.To, key)
+		}
+		change.To = SensitiveValue
+	}
+	change.TextDiff = nil
+	change.Sensitive = true
+	return change
+}
+
+// redactSecret returns a copy of a decoded Secret with the values of data and
+// the last-applied-configuration annotation replaced by SensitiveValue
+func redactSecret(obj map[string]interface{}) map[string]interface{} {
+	if obj == nil {
+		return nil
+	}
+
+	redacted := make(map[string]interface{}, len(obj))
+	for key, value := range obj {
+		redacted[key] = value
+	}
+
+	if data, ok := obj["data"].(map[string]interface{}); ok {
+		redactedData := make(map[string]interface{}, len(data))
+		for key := range data {
+			redactedData[key] = SensitiveValue
+		}
+		redacted["data"] = redactedData
+	}
+
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if _, ok := annotations[k8s.LastAppliedAnnotation]; ok {
+		redactedAnnotations := make(map[string]interface{}, len(annotations))
+		for key, value := range annotations {
+			redactedAnnotations[key] = value
+		}
+		redactedAnnotations[k8s.LastAppliedAnnotation] = SensitiveValue
+
+		redactedMetadata := make(map[string]interface{}, len(metadata))
+		for key, value := range metadata {
+			redactedMetadata[key] = value
+		}
+		redactedMetadata["annotations"] = redactedAnnotations
+		redacted["metadata"] = redactedMetadata
+	}
+	return redacted
+}
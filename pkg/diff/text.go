@@ -0,0 +1,145 @@
+package diff
+
+import "strings"
+
+// textDiffContext is the number of unchanged lines shown around each change
+const textDiffContext = 3
+
+// addTextDiffs gives every change between two strings a line diff when either
+// side has at least minLines lines. Changes that already have one are kept.
+func addTextDiffs(changes map[string]FieldChange, minLines int) {
+	for key, change := range changes {
+		from, fromOK := change.From.(string)
+		to, toOK := change.To.(string)
+		if !fromOK || !toOK || change.TextDiff != nil {
+			continue
+		}
+		if max(len(splitLines(from)), len(splitLines(to))) < minLines {
+			continue
+		}
+		change.TextDiff = unifiedDiff(from, to)
+		changes[key] = change
+	}
+}
+
+// Hunk is one block of a unified line diff between two strings
+type Hunk struct {
+	// FromLine and ToLine are the 1-based first lines of the hunk in the old
+	// and new text; as in `diff -u`, a side without lines in the hunk gives the
+	// line after which the others were inserted or removed
+	FromLine  int `json:"from_line"`
+	FromCount int `json:"from_count"`
+	ToLine    int `json:"to_line"`
+	ToCount   int `json:"to_count"`
+	// Lines are the lines of the hunk prefixed with " " (unchanged), "-"
+	// (removed) or "+" (added), without line terminators
+	Lines []string `json:"lines"`
+}
+
+// lineOp is one line of an edit script: kind is ' ', '-' or '+', before and
+// after are the positions reached in each text
+type lineOp struct {
+	kind          byte
+	before, after int
+}
+
+// unifiedDiff returns the hunks of a line diff between two strings, with
+// textDiffContext lines of context. A final line without a newline differs
+// from the same line with one.
+func unifiedDiff(from, to string) []Hunk {
+	before := splitLines(from)
+	after := splitLines(to)
+	matches := longestCommonSubsequence(len(before), len(after), func(i, j int) bool {
+		return before[i] == after[j]
+	})
+
+	// Sentinel so the trailing run is handled like the others
+	matches = append(matches, match{len(before), len(after)})
+	var ops []lineOp
+	i, j := 0, 0
+	for _, m := range matches {
+		for ; i < m.before; i++ {
+			ops = append(ops, lineOp{'-', i, j})
+		}
+		for ; j < m.after; j++ {
+			ops = append(ops, lineOp{'+', i, j})
+		}
+		if m.before < len(before) {
+			ops = append(ops, lineOp{' ', i, j})
+			i++
+			j++
+		}
+	}
+
+	var hunks []Hunk
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+
+		// Extend the hunk over changes separated by at most twice the context
+		start := max(k-textDiffContext, 0)
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run < len(ops) && run-end <= 2*textDiffContext {
+				end = run
+				continue
+			}
+			end = min(end+textDiffContext, len(ops))
+			break
+		}
+
+		hunks = append(hunks, newHunk(ops[start:end], before, after))
+		k = end
+	}
+	return hunks
+}
+
+// newHunk renders the lines of an edit script
+func newHunk(ops []lineOp, before, after []string) Hunk {
+	hunk := Hunk{FromLine: ops[0].before + 1, ToLine: ops[0].after + 1}
+	for _, op := range ops {
+		switch op.kind {
+		case ' ':
+			hunk.FromCount++
+			hunk.ToCount++
+			hunk.Lines = append(hunk.Lines, " "+strings.TrimSuffix(before[op.before], "\n"))
+		case '-':
+			hunk.FromCount++
+			hunk.Lines = append(hunk.Lines, "-"+strings.TrimSuffix(before[op.before], "\n"))
+		case '+':
+			hunk.ToCount++
+			hunk.Lines = append(hunk.Lines, "+"+strings.TrimSuffix(after[op.after], "\n"))
+		}
+	}
+	if hunk.FromCount == 0 {
+		hunk.FromLine--
+	}
+	if hunk.ToCount == 0 {
+		hunk.ToLine--
+	}
+	return hunk
+}
+
+// splitLines splits a string into lines, keeping their terminators
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// isMultiline checks whether a string has more than one line
+func isMultiline(s string) bool {
+	return strings.Contains(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,184 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"skiff/pkg/k8s"
+)
+
+// gitBlob is a file in a git tree
+type gitBlob struct {
+	path string // path from the repository root
+	oid  string
+}
+
+// LoadGit reads the manifests at paths in revision rev of the git repository
+// containing opts.Dir into one k8s.Manifest, like Load, without checking them
+// out. paths are relative to opts.Dir; directories are searched recursively
+// with the same rules as Load and an empty list means the whole repository.
+// A path that does not exist in rev contributes no objects, so files added or
+// deleted between two revisions show up as creates and deletes.
+// Object sources are named "<rev>:<path>", the path being relative to the
+// repository root as in `git show`. It returns the full hash of the commit.
+func LoadGit(rev string, paths []string, opts Options) (*k8s.Manifest, string, error) {
+	commit, err := git(opts.Dir, nil, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return nil, "", fmt.Errorf("unknown revision %q: %w", rev, err)
+	}
+	commit = strings.TrimSpace(commit)
+
+	prefix, err := git(opts.Dir, nil, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, "", err
+	}
+	prefix = strings.TrimSpace(prefix)
+
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	selected := make(map[string]gitBlob)
+	for _, p := range paths {
+		root := path.Clean(path.Join(prefix, filepath.ToSlash(p)))
+		if root == ".." || strings.HasPrefix(root, "../") {
+			return nil, "", fmt.Errorf("%s is outside the repository", p)
+		}
+
+		blobs, err := listBlobs(opts.Dir, commit, root)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, blob := range blobs {
+			// A file named explicitly is always loaded
+			if blob.path == root {
+				selected[blob.path] = blob
+				continue
+			}
+			rel := blob.path
+			if root != "." {
+				rel = strings.TrimPrefix(blob.path, root+"/")
+			}
+			if selectFile(rel, opts) {
+				selected[blob.path] = blob
+			}
+		}
+	}
+
+	blobs := make([]gitBlob, 0, len(selected))
+	for _, blob := range selected {
+		blobs = append(blobs, blob)
+	}
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].path < blobs[j].path })
+
+	contents, err := readBlobs(opts.Dir, blobs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	inputs := make([]k8s.Input, len(blobs))
+	for i, blob := range blobs {
+		inputs[i] = k8s.Input{Name: rev + ":" + blob.path, Reader: bytes.NewReader(contents[i])}
+	}
+
+	manifest, err := k8s.ParseManifests(inputs, opts.Parse)
+	if err != nil {
+		return nil, "", err
+	}
+	return manifest, commit, nil
+}
+
+// listBlobs lists the files of a commit below root, a path from the repository
+// root ("." for all files). Submodules are skipped.
+func listBlobs(dir, commit, root string) ([]gitBlob, error) {
+	args := []string{"ls-tree", "-r", "-z", "--full-tree", commit}
+	if root != "." {
+		args = append(args, "--", root)
+	}
+	out, err := git(dir, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var blobs []gitBlob
+	for _, entry := range strings.Split(out, "\x00") {
+		// <mode> SP <type> SP <object> TAB <file>
+		info, name, ok := strings.Cut(entry, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(info)
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		blobs = append(blobs, gitBlob{path: name, oid: fields[2]})
+	}
+	return blobs, nil
+}
+
+// readBlobs reads the contents of blobs with a single `git cat-file --batch`
+func readBlobs(dir string, blobs []gitBlob) ([][]byte, error) {
+	if len(blobs) == 0 {
+		return nil, nil
+	}
+
+	var request strings.Builder
+	for _, blob := range blobs {
+		request.WriteString(blob.oid + "\n")
+	}
+	out, err := git(dir, strings.NewReader(request.String()), "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(strings.NewReader(out))
+	contents := make([][]byte, len(blobs))
+	for i, blob := range blobs {
+		// <oid> SP <type> SP <size> LF <contents> LF
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", blob.path, err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("failed to read %s: %s", blob.path, strings.TrimSpace(header))
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", blob.path, err)
+		}
+
+		contents[i] = make([]byte, size+1)
+		if _, err := io.ReadFull(reader, contents[i]); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", blob.path, err)
+		}
+		contents[i] = contents[i][:size]
+	}
+	return contents, nil
+}
+
+// git runs a git command in dir and returns its output
+func git(dir string, stdin io.Reader, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
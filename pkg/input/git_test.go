@@ -0,0 +1,115 @@
+package input
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// runGit runs a git command in dir, failing the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := git(dir, nil, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestLoadGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet")
+	writeFiles(t, dir, map[string]string{
+		"deploy/app.yaml":  configMap("app"),
+		"deploy/notes.txt": "not a manifest",
+		"other/db.yaml":    configMap("db"),
+	})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "--quiet", "-m", "first")
+	runGit(t, dir, "tag", "first")
+
+	writeFiles(t, dir, map[string]string{
+		"deploy/app.yaml":        configMap("renamed"),
+		"deploy/nested/web.json": `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "web"}}`,
+	})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "--quiet", "-m", "second")
+
+	// Uncommitted changes are not read
+	writeFiles(t, dir, map[string]string{"deploy/app.yaml": configMap("uncommitted")})
+
+	tests := []struct {
+		name     string
+		rev      string
+		paths    []string
+		dir      string
+		expected []string
+	}{
+		{
+			name:     "directory at first revision",
+			rev:      "first",
+			paths:    []string{"deploy"},
+			expected: []string{"app"},
+		},
+		{
+			name:     "directory at head",
+			rev:      "HEAD",
+			paths:    []string{"deploy"},
+			expected: []string{"renamed", "web"},
+		},
+		{
+			name:     "whole repository",
+			rev:      "first",
+			expected: []string{"app", "db"},
+		},
+		{
+			name:     "paths relative to a subdirectory",
+			rev:      "HEAD",
+			paths:    []string{"nested", "../other/db.yaml"},
+			dir:      "deploy",
+			expected: []string{"db", "web"},
+		},
+		{
+			name:  "missing path",
+			rev:   "first",
+			paths: []string{"deploy/nested"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, commit, err := LoadGit(tt.rev, tt.paths, Options{Dir: filepath.Join(dir, tt.dir)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if expected := runGit(t, dir, "rev-parse", tt.rev); commit+"\n" != expected {
+				t.Errorf("expected commit %s, got %s", expected, commit)
+			}
+			if len(manifest.Objects) != len(tt.expected) {
+				t.Errorf("expected %d objects, got %d", len(tt.expected), len(manifest.Objects))
+			}
+			for _, name := range tt.expected {
+				if _, ok := manifest.Objects["core/ConfigMap/default/"+name]; !ok {
+					t.Errorf("expected object %s", name)
+				}
+			}
+		})
+	}
+
+	manifest, _, err := LoadGit("first", []string{"deploy"}, Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source := manifest.Sources["core/ConfigMap/default/app"]; source.File != "first:deploy/app.yaml" {
+		t.Errorf("expected source first:deploy/app.yaml, got %v", source)
+	}
+
+	if _, _, err := LoadGit("no-such-rev", nil, Options{Dir: dir}); err == nil {
+		t.Errorf("expected an error for an unknown revision")
+	}
+}
@@ -0,0 +1,178 @@
+package input
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/release"
+
+	"skiff/pkg/k8s"
+)
+
+// DefaultReleaseName is the release name charts are rendered with, as in `helm template`
+const DefaultReleaseName = "release-name"
+
+// HelmOptions controls how charts are rendered
+type HelmOptions struct {
+	// ReleaseName is .Release.Name. Defaults to DefaultReleaseName.
+	ReleaseName string
+	// ValueFiles are merged in order, like `helm template -f`
+	ValueFiles []string
+	// Set holds values in `helm template --set` syntax, applied after ValueFiles
+	Set []string
+	// IncludeCRDs renders the chart's crds/ directory, like `helm template --include-crds`
+	IncludeCRDs bool
+	// SkipHooks leaves out hooks, including tests, like `helm template --no-hooks`
+	SkipHooks bool
+	// SkipTests leaves out test hooks, like `helm template --skip-tests`
+	SkipTests bool
+}
+
+// IsHelmChart checks whether path is a chart directory (with a Chart.yaml) or
+// a packaged chart (.tgz)
+func IsHelmChart(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if !info.IsDir() {
+		return strings.HasSuffix(path, ".tgz")
+	}
+	chartFile, err := os.Stat(filepath.Join(path, "Chart.yaml"))
+	return err == nil && !chartFile.IsDir()
+}
+
+// LoadHelmChart renders the chart at path in-process, like `helm template`
+// without cluster access, and parses the result. The release namespace is
+// opts.Parse.DefaultNamespace, or "default". Each object's source names the
+// template it was rendered from (within the archive for a .tgz, as
+// "<archive>:<path>"), has no line numbers, and marks hooks and tests in Hook.
+func LoadHelmChart(path string, opts Options) (*k8s.Manifest, error) {
+	chart, err := loader.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if chart.Metadata.Dependencies != nil {
+		if err := action.CheckDependencies(chart, chart.Metadata.Dependencies); err != nil {
+			return nil, fmt.Errorf("chart %s: %w", path, err)
+		}
+	}
+
+	valueOpts := values.Options{ValueFiles: opts.Helm.ValueFiles, Values: opts.Helm.Set}
+	vals, err := valueOpts.MergeValues(getter.Providers{})
+	if err != nil {
+		return nil, err
+	}
+
+	client := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	client.DryRun = true
+	client.DryRunOption = "client"
+	client.ClientOnly = true
+	client.Replace = true
+	client.IncludeCRDs = opts.Helm.IncludeCRDs
+	client.ReleaseName = opts.Helm.ReleaseName
+	if client.ReleaseName == "" {
+		client.ReleaseName = DefaultReleaseName
+	}
+	client.Namespace = opts.Parse.DefaultNamespace
+	if client.Namespace == "" {
+		client.Namespace = "default"
+	}
+
+	rel, err := client.Run(chart, vals)
+	if err != nil {
+		return nil, fmt.Errorf("helm template %s: %w", path, err)
+	}
+
+	// Render like `helm template`: the manifest, then the hooks
+	var rendered strings.Builder
+	fmt.Fprintln(&rendered, strings.TrimSpace(rel.Manifest))
+	for _, hook := range rel.Hooks {
+		if opts.Helm.SkipHooks || (opts.Helm.SkipTests && isTestHook(hook)) {
+			continue
+		}
+		fmt.Fprintf(&rendered, "---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+	}
+	templates := templateSources(rendered.String(), hookEvents(rel.Hooks))
+
+	manifest, err := k8s.ParseManifests([]k8s.Input{{Name: path, Reader: strings.NewReader(rendered.String())}}, opts.Parse)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, source := range manifest.Sources {
+		rendered := source
+		source = k8s.Source{File: path, Document: rendered.Document}
+		// The template is named by the last "# Source:" comment before the object
+		for _, template := range templates {
+			if template.line > rendered.Line {
+				break
+			}
+			source.File = templateFile(path, template.path)
+			source.Hook = template.hook
+		}
+		manifest.Sources[key] = source
+		delete(manifest.Nodes, key)
+	}
+	return manifest, nil
+}
+
+// renderedTemplate is a "# Source:" comment in rendered chart output
+type renderedTemplate struct {
+	line int    // 1-based line of the comment
+	path string // template path, starting with the chart name
+	hook string // hook events, if the template is a hook
+}
+
+// templateSources finds the "# Source:" comments in rendered chart output
+func templateSources(rendered string, hooks map[string]string) []renderedTemplate {
+	var templates []renderedTemplate
+	scanner := bufio.NewScanner(strings.NewReader(rendered))
+	scanner.Buffer(nil, len(rendered)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if path, ok := strings.CutPrefix(scanner.Text(), "# Source: "); ok {
+			templates = append(templates, renderedTemplate{line: line, path: path, hook: hooks[path]})
+		}
+	}
+	return templates
+}
+
+// hookEvents maps the template path of each hook to its events, comma separated
+func hookEvents(hooks []*release.Hook) map[string]string {
+	events := make(map[string]string, len(hooks))
+	for _, hook := range hooks {
+		names := make([]string, len(hook.Events))
+		for i, event := range hook.Events {
+			names[i] = event.String()
+		}
+		events[hook.Path] = strings.Join(names, ",")
+	}
+	return events
+}
+
+// templateFile returns the file a template was rendered from. Template paths
+// start with the chart name, which need not match the chart's directory name.
+func templateFile(chartPath, templatePath string) string {
+	if strings.HasSuffix(chartPath, ".tgz") {
+		return chartPath + ":" + templatePath
+	}
+	_, rel, _ := strings.Cut(templatePath, "/")
+	return filepath.Join(chartPath, filepath.FromSlash(rel))
+}
+
+// isTestHook checks whether a hook is a chart test
+func isTestHook(hook *release.Hook) bool {
+	for _, event := range hook.Events {
+		if event == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
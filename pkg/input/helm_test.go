@@ -0,0 +1,153 @@
+package input
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// helmChart is a chart with a regular template, a hook and a test
+var helmChart = map[string]string{
+	"chart/Chart.yaml": `apiVersion: v2
+name: app
+version: 0.1.0
+`,
+	"chart/values.yaml": `replicas: 1
+mode: default
+`,
+	"chart/templates/configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-settings
+  namespace: {{ .Release.Namespace }}
+data:
+  mode: {{ .Values.mode }}
+  replicas: "{{ .Values.replicas }}"
+`,
+	"chart/templates/migrate.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .Release.Name }}-migrate
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: migrate:1
+`,
+	"chart/templates/tests/ping.yaml": `apiVersion: v1
+kind: Pod
+metadata:
+  name: {{ .Release.Name }}-ping
+  annotations:
+    helm.sh/hook: test
+spec:
+  containers:
+  - name: ping
+    image: busybox
+`,
+	"values-prod.yaml": `mode: prod
+`,
+}
+
+func TestLoadHelmChart(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, helmChart)
+	chart := filepath.Join(dir, "chart")
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected map[string]string
+	}{
+		{
+			name: "defaults",
+			expected: map[string]string{
+				"core/ConfigMap/default/release-name-settings": "",
+				"batch/Job/default/release-name-migrate":       "pre-install,pre-upgrade",
+				"core/Pod/default/release-name-ping":           "test",
+			},
+		},
+		{
+			name: "release name and namespace",
+			opts: Options{Helm: HelmOptions{ReleaseName: "web"}},
+			expected: map[string]string{
+				"core/ConfigMap/default/web-settings": "",
+				"batch/Job/default/web-migrate":       "pre-install,pre-upgrade",
+				"core/Pod/default/web-ping":           "test",
+			},
+		},
+		{
+			name: "skip tests",
+			opts: Options{Helm: HelmOptions{SkipTests: true}},
+			expected: map[string]string{
+				"core/ConfigMap/default/release-name-settings": "",
+				"batch/Job/default/release-name-migrate":       "pre-install,pre-upgrade",
+			},
+		},
+		{
+			name: "skip hooks",
+			opts: Options{Helm: HelmOptions{SkipHooks: true}},
+			expected: map[string]string{
+				"core/ConfigMap/default/release-name-settings": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := Load(chart, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(manifest.Objects) != len(tt.expected) {
+				t.Errorf("expected %d objects, got %d", len(tt.expected), len(manifest.Objects))
+			}
+			for key, hook := range tt.expected {
+				source, ok := manifest.Sources[key]
+				if !ok {
+					t.Errorf("expected object %s", key)
+					continue
+				}
+				if source.Hook != hook {
+					t.Errorf("%s: expected hook %q, got %q", key, hook, source.Hook)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadHelmChartValues(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, helmChart)
+
+	opts := Options{
+		Helm: HelmOptions{
+			ValueFiles: []string{filepath.Join(dir, "values-prod.yaml")},
+			Set:        []string{"replicas=3"},
+		},
+	}
+	opts.Parse.DefaultNamespace = "team-a"
+	manifest, err := Load(filepath.Join(dir, "chart"), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	key := "core/ConfigMap/team-a/release-name-settings"
+	configMap, ok := manifest.Objects[key]
+	if !ok {
+		t.Fatalf("expected object %s, got %v", key, manifest.Objects)
+	}
+	data := configMap["data"].(map[string]interface{})
+	if data["mode"] != "prod" || data["replicas"] != "3" {
+		t.Errorf("expected values from the values file and --set, got %v", data)
+	}
+
+	expected := filepath.Join(dir, "chart", "templates", "configmap.yaml")
+	if source := manifest.Sources[key]; source.File != expected || source.Line != 0 {
+		t.Errorf("expected source %s, got %v", expected, source)
+	}
+}
@@ -0,0 +1,184 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"skiff/pkg/k8s"
+)
+
+// Stdin is the argument that reads manifests from standard input
+const Stdin = "-"
+
+// StdinName names standard input in object sources and error messages
+const StdinName = "<stdin>"
+
+// manifestExtensions lists the file extensions loaded from directories
+var manifestExtensions = []string{".yaml", ".yml", ".json"}
+
+// Options controls how manifests are loaded from a path
+type Options struct {
+	// Parse is passed on to k8s.ParseManifests; its File is ignored
+	Parse k8s.ParseOptions
+	// Include limits the files loaded from a directory to those matching at
+	// least one glob. Globs are matched against the path relative to the
+	// directory and against the file name, using filepath.Match.
+	Include []string
+	// Exclude skips files and directories matching any glob, matched like Include
+	Exclude []string
+	// Stdin is read for the "-" argument. Defaults to os.Stdin.
+	Stdin io.Reader
+	// Dir is the directory git runs in for LoadGit. Defaults to the current directory.
+	Dir string
+	// Helm controls how charts are rendered
+	Helm HelmOptions
+}
+
+// Load reads the manifests at path into one k8s.Manifest. path is "-" for
+// standard input, a file, or a directory whose *.yaml, *.yml and *.json files
+// are loaded recursively in lexical order. Hidden files and directories are
+// skipped. A chart directory or .tgz is rendered with LoadHelmChart, and a
+// directory with a kustomization file is built with LoadKustomization.
+// Objects from all files share one key space, so the same object in two files
+// is reported with both locations according to opts.Parse.Duplicates.
+func Load(path string, opts Options) (*k8s.Manifest, error) {
+	if path == Stdin {
+		stdin := opts.Stdin
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		return k8s.ParseManifests([]k8s.Input{{Name: StdinName, Reader: stdin}}, opts.Parse)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsHelmChart(path) {
+		return LoadHelmChart(path, opts)
+	}
+	if info.IsDir() && IsKustomization(path) {
+		return LoadKustomization(path, opts)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = findManifests(path, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Read files up front rather than keeping one open per file, which would
+	// run into the open file limit on large directories
+	inputs := make([]k8s.Input, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, k8s.Input{Name: file, Reader: bytes.NewReader(data)})
+	}
+
+	return k8s.ParseManifests(inputs, opts.Parse)
+}
+
+// findManifests walks dir and returns the manifest files selected by opts
+func findManifests(dir string, opts Options) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if isHidden(entry.Name()) || matchesAny(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if selectFile(rel, opts) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// selectFile checks whether a file found below a directory is loaded, given its
+// slash-separated path relative to that directory. Files in hidden or excluded
+// directories are skipped like the directories themselves.
+func selectFile(rel string, opts Options) bool {
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		if isHidden(part) || matchesAny(opts.Exclude, strings.Join(parts[:i+1], "/")) {
+			return false
+		}
+	}
+	if !hasManifestExtension(rel) {
+		return false
+	}
+	return len(opts.Include) == 0 || matchesAny(opts.Include, rel)
+}
+
+// isHidden checks whether a file or directory name is hidden
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// ValidateGlobs checks that globs are valid filepath.Match patterns
+func ValidateGlobs(globs []string) error {
+	for _, glob := range globs {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+	}
+	return nil
+}
+
+// matchesAny checks whether a slash-separated relative path or its base name
+// matches any of the globs
+func matchesAny(globs []string, rel string) bool {
+	base := rel[strings.LastIndex(rel, "/")+1:]
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, rel); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasManifestExtension checks whether a file name has a manifest extension
+func hasManifestExtension(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, manifestExt := range manifestExtensions {
+		if ext == manifestExt {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package input
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"skiff/pkg/k8s"
+)
+
+// writeFiles creates files below dir, keyed by slash-separated relative path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func configMap(name string) string {
+	return "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\n"
+}
+
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app.yaml":            configMap("app"),
+		"nested/db.yml":       configMap("db"),
+		"nested/deep/x.json":  `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "json"}}`,
+		"README.md":           "not a manifest",
+		"values.txt":          configMap("ignored"),
+		".hidden/secret.yaml": configMap("hidden"),
+		"test/fixture.yaml":   configMap("fixture"),
+	})
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{
+			name:     "all manifests",
+			expected: []string{"app", "db", "fixture", "json"},
+		},
+		{
+			name:     "include by file name",
+			opts:     Options{Include: []string{"*.yml", "*.json"}},
+			expected: []string{"db", "json"},
+		},
+		{
+			name:     "include by relative path",
+			opts:     Options{Include: []string{"nested/*"}},
+			expected: []string{"db"},
+		},
+		{
+			name:     "exclude directory",
+			opts:     Options{Exclude: []string{"test"}},
+			expected: []string{"app", "db", "json"},
+		},
+		{
+			name:     "exclude file",
+			opts:     Options{Exclude: []string{"app.yaml", "deep"}},
+			expected: []string{"db", "fixture"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := Load(dir, tt.opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(manifest.Objects) != len(tt.expected) {
+				t.Errorf("expected %d objects, got %d", len(tt.expected), len(manifest.Objects))
+			}
+			for _, name := range tt.expected {
+				key := "core/ConfigMap/default/" + name
+				if _, ok := manifest.Objects[key]; !ok {
+					t.Errorf("expected object %s", key)
+				}
+			}
+		})
+	}
+
+	manifest, err := Load(dir, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := filepath.Join(dir, "nested", "db.yml")
+	if source := manifest.Sources["core/ConfigMap/default/db"]; source.File != expected || source.Line != 1 {
+		t.Errorf("expected source %s:1, got %v", expected, source)
+	}
+}
+
+func TestLoadDuplicatesAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.yaml": configMap("app"),
+		"b.yaml": "# copy\n---\n" + configMap("app"),
+	})
+
+	_, err := Load(dir, Options{})
+	var duplicate *k8s.DuplicateObjectError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("expected a duplicate object error, got %v", err)
+	}
+
+	first := k8s.Source{File: filepath.Join(dir, "a.yaml"), Document: 1, Line: 1, Column: 1}
+	second := k8s.Source{File: filepath.Join(dir, "b.yaml"), Document: 1, Line: 3, Column: 1}
+	if duplicate.First != first || duplicate.Second != second {
+		t.Errorf("expected %v and %v, got %v and %v", first, second, duplicate.First, duplicate.Second)
+	}
+}
+
+func TestLoadCRDAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"crd.yaml": `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusterwidgets.example.com
+spec:
+  group: example.com
+  scope: Cluster
+  names:
+    kind: ClusterWidget
+`,
+		"widget.yaml": `apiVersion: example.com/v1
+kind: ClusterWidget
+metadata:
+  name: main
+`,
+	})
+
+	manifest, err := Load(dir, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := manifest.Objects["example.com/ClusterWidget//main"]; !ok {
+		t.Errorf("expected the custom resource to be cluster-scoped, got keys %v", manifest.Objects)
+	}
+}
+
+func TestLoadStdin(t *testing.T) {
+	manifest, err := Load(Stdin, Options{Stdin: strings.NewReader(configMap("piped"))})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	source, ok := manifest.Sources["core/ConfigMap/default/piped"]
+	if !ok || source.File != StdinName {
+		t.Errorf("expected object read from %s, got %v", StdinName, source)
+	}
+}
@@ -0,0 +1,136 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"skiff/pkg/k8s"
+)
+
+// IsKustomization checks whether dir holds a kustomization file
+func IsKustomization(dir string) bool {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadKustomization builds the kustomization in dir in-process, like
+// `kustomize build dir` with its default load restrictions (files outside the
+// kustomization root cannot be read, other kustomizations can), and parses
+// the result. Each object's source names the file it was read from, or the
+// kustomization file of the generator that created it, relative to the
+// current directory like dir; its document is the position in the build
+// output. Sources have no line numbers, since transformers change objects
+// after they were read.
+func LoadKustomization(dir string, opts Options) (*k8s.Manifest, error) {
+	fs := filesys.MakeFsOnDisk()
+	root, _, err := fs.CleanedAbs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	originFS := &originFileSystem{FileSystem: fs, root: string(root)}
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := kustomizer.Run(originFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("kustomize build %s: %w", dir, err)
+	}
+
+	var origins []string
+	for _, resource := range resources.Resources() {
+		origin, err := resource.GetOrigin()
+		if err != nil {
+			return nil, err
+		}
+		file := dir
+		switch {
+		case origin == nil:
+		case origin.Repo != "":
+			file = origin.Repo + "//" + origin.Path
+		case origin.Path != "":
+			file = filepath.Join(dir, origin.Path)
+		case origin.ConfiguredIn != "":
+			file = filepath.Join(dir, origin.ConfiguredIn)
+		}
+		origins = append(origins, file)
+	}
+
+	// Only keep the origin annotations when the kustomization asks for them,
+	// as `kustomize build` does
+	if originFS.injected {
+		if err := resources.RemoveOriginAnnotations(); err != nil {
+			return nil, err
+		}
+	}
+
+	rendered, err := resources.AsYaml()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := k8s.ParseManifests([]k8s.Input{{Name: dir, Reader: bytes.NewReader(rendered)}}, opts.Parse)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, source := range manifest.Sources {
+		if source.Document >= 1 && source.Document <= len(origins) {
+			manifest.Sources[key] = k8s.Source{File: origins[source.Document-1], Document: source.Document}
+		}
+		delete(manifest.Nodes, key)
+	}
+	return manifest, nil
+}
+
+// originFileSystem reads from disk, but turns on origin annotations in the
+// kustomization file of the root so each built object records where it came from
+type originFileSystem struct {
+	filesys.FileSystem
+	root     string
+	injected bool
+}
+
+// ReadFile implements filesys.FileSystem
+func (fs *originFileSystem) ReadFile(path string) ([]byte, error) {
+	data, err := fs.FileSystem.ReadFile(path)
+	if err != nil || filepath.Dir(path) != fs.root || !isKustomizationFile(filepath.Base(path)) {
+		return data, err
+	}
+
+	var kustomization map[string]interface{}
+	if err := yaml.Unmarshal(data, &kustomization); err != nil || kustomization == nil {
+		// Leave reporting invalid kustomizations to kustomize
+		return data, nil
+	}
+
+	metadata, _ := kustomization["buildMetadata"].([]interface{})
+	for _, option := range metadata {
+		if option == types.OriginAnnotations {
+			return data, nil
+		}
+	}
+	kustomization["buildMetadata"] = append(metadata, types.OriginAnnotations)
+	fs.injected = true
+	return yaml.Marshal(kustomization)
+}
+
+// isKustomizationFile checks whether a file name is a kustomization file name
+func isKustomizationFile(name string) bool {
+	for _, recognized := range konfig.RecognizedKustomizationFileNames() {
+		if name == recognized {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package input
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// kustomizeTree is a base with a generated ConfigMap and an overlay that patches it
+var kustomizeTree = map[string]string{
+	"base/kustomization.yaml": `resources:
+- deployment.yaml
+configMapGenerator:
+- name: settings
+  literals:
+  - mode=base
+generatorOptions:
+  disableNameSuffixHash: true
+`,
+	"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+`,
+	"overlays/prod/kustomization.yaml": `resources:
+- ../../base
+- service.yaml
+namespace: prod
+patches:
+- patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 3
+  target:
+    kind: Deployment
+`,
+	"overlays/prod/service.yaml": `apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`,
+	"overlays/escape/kustomization.yaml": `resources:
+- ../../base/deployment.yaml
+`,
+}
+
+func TestLoadKustomization(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, kustomizeTree)
+	overlay := filepath.Join(dir, "overlays", "prod")
+
+	manifest, err := Load(overlay, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sources := map[string]string{
+		"apps/Deployment/prod/web":     filepath.Join(dir, "base", "deployment.yaml"),
+		"core/ConfigMap/prod/settings": filepath.Join(dir, "base", "kustomization.yaml"),
+		"core/Service/prod/web":        filepath.Join(overlay, "service.yaml"),
+	}
+	if len(manifest.Objects) != len(sources) {
+		t.Errorf("expected %d objects, got %d", len(sources), len(manifest.Objects))
+	}
+	for key, file := range sources {
+		source, ok := manifest.Sources[key]
+		if !ok {
+			t.Errorf("expected object %s", key)
+			continue
+		}
+		if source.File != file || source.Line != 0 {
+			t.Errorf("%s: expected source %s, got %v", key, file, source)
+		}
+	}
+
+	deployment := manifest.Objects["apps/Deployment/prod/web"]
+	if replicas := deployment["spec"].(map[string]interface{})["replicas"]; replicas != 3 {
+		t.Errorf("expected the overlay patch to set replicas to 3, got %v", replicas)
+	}
+	if _, ok := deployment["metadata"].(map[string]interface{})["annotations"]; ok {
+		t.Errorf("expected origin annotations to be removed, got %v", deployment["metadata"])
+	}
+}
+
+func TestLoadKustomizationLoadRestrictions(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, kustomizeTree)
+
+	if _, err := Load(filepath.Join(dir, "overlays", "escape"), Options{}); err == nil {
+		t.Errorf("expected an error for a file outside the kustomization root")
+	}
+}
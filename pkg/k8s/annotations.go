@@ -0,0 +1,33 @@
+package k8s
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// IgnoreAnnotation set to "true" leaves an object out of the diff entirely
+	IgnoreAnnotation = "skiff.io/ignore"
+	// IgnoreFieldsAnnotation lists field paths, separated by commas, whose
+	// changes are not reported, e.g. "spec.replicas" on a Deployment scaled by
+	// an HPA. Paths use the syntax of ignore rules.
+	IgnoreFieldsAnnotation = "skiff.io/ignore-fields"
+)
+
+// IgnoreDirectives reads the skiff.io ignore annotations of an object
+func IgnoreDirectives(obj map[string]interface{}) (ignore bool, fields []string) {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+
+	if value, ok := annotations[IgnoreAnnotation].(string); ok {
+		ignore, _ = strconv.ParseBool(strings.TrimSpace(value))
+	}
+	if value, ok := annotations[IgnoreFieldsAnnotation].(string); ok {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return ignore, fields
+}
@@ -0,0 +1,227 @@
+package k8s
+
+import (
+	"strings"
+)
+
+// CoreGroup is the name used in object keys for the legacy core API group ("v1")
+const CoreGroup = "core"
+
+// movedKinds maps kinds that were served from a legacy API group to the group
+// that serves them today, so the same object keeps its key across the move
+var movedKinds = map[string]string{
+	"extensions/Deployment":        "apps",
+	"extensions/DaemonSet":         "apps",
+	"extensions/ReplicaSet":        "apps",
+	"extensions/Ingress":           "networking.k8s.io",
+	"extensions/NetworkPolicy":     "networking.k8s.io",
+	"extensions/PodSecurityPolicy": "policy",
+}
+
+// SplitAPIVersion splits an apiVersion into its group and version. The core
+// group is returned as CoreGroup.
+func SplitAPIVersion(apiVersion string) (group, version string) {
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		return apiVersion[:i], apiVersion[i+1:]
+	}
+	return CoreGroup, apiVersion
+}
+
+// CanonicalGroup returns the API group a kind is served from today, mapping
+// kinds that moved out of a legacy group to their current group
+func CanonicalGroup(group, kind string) string {
+	if moved, ok := movedKinds[group+"/"+kind]; ok {
+		return moved
+	}
+	return group
+}
+
+// conversionFunc rewrites an object in place from one API version's schema to another's
+type conversionFunc func(obj map[string]interface{})
+
+// conversions lists known conversions between API versions of the same kind,
+// keyed by "kind:fromAPIVersion:toAPIVersion". A nil func means the schemas
+// are the same and only apiVersion changes.
+var conversions = map[string]conversionFunc{
+	"HorizontalPodAutoscaler:autoscaling/v2beta2:autoscaling/v2":   nil,
+	"HorizontalPodAutoscaler:autoscaling/v2beta1:autoscaling/v2":   convertHPAV2beta1,
+	"HorizontalPodAutoscaler:autoscaling/v1:autoscaling/v2":        convertHPAV1,
+	"CronJob:batch/v1beta1:batch/v1":                               nil,
+	"PodDisruptionBudget:policy/v1beta1:policy/v1":                 nil,
+	"Ingress:extensions/v1beta1:networking.k8s.io/v1":              convertIngressV1beta1,
+	"Ingress:networking.k8s.io/v1beta1:networking.k8s.io/v1":       convertIngressV1beta1,
+	"NetworkPolicy:extensions/v1beta1:networking.k8s.io/v1":        nil,
+	"Deployment:extensions/v1beta1:apps/v1":                        nil,
+	"Deployment:apps/v1beta1:apps/v1":                              nil,
+	"Deployment:apps/v1beta2:apps/v1":                              nil,
+	"DaemonSet:extensions/v1beta1:apps/v1":                         nil,
+	"DaemonSet:apps/v1beta2:apps/v1":                               nil,
+	"ReplicaSet:extensions/v1beta1:apps/v1":                        nil,
+	"ReplicaSet:apps/v1beta2:apps/v1":                              nil,
+	"StatefulSet:apps/v1beta1:apps/v1":                             nil,
+	"StatefulSet:apps/v1beta2:apps/v1":                             nil,
+	"PriorityClass:scheduling.k8s.io/v1beta1:scheduling.k8s.io/v1": nil,
+	"StorageClass:storage.k8s.io/v1beta1:storage.k8s.io/v1":        nil,
+}
+
+// ConvertToVersion returns a copy of obj converted to apiVersion, if a
+// conversion between the two versions of its kind is known
+func ConvertToVersion(obj map[string]interface{}, apiVersion string) (map[string]interface{}, bool) {
+	kind, _ := obj["kind"].(string)
+	from, _ := obj["apiVersion"].(string)
+	if from == apiVersion {
+		return obj, true
+	}
+
+	convert, ok := conversions[kind+":"+from+":"+apiVersion]
+	if !ok {
+		return nil, false
+	}
+
+	converted := deepCopy(obj).(map[string]interface{})
+	converted["apiVersion"] = apiVersion
+	if convert != nil {
+		convert(converted)
+	}
+	return converted, true
+}
+
+// deepCopy copies decoded YAML values so conversions do not modify their input
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			copied[key] = deepCopy(nested)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, nested := range v {
+			copied[i] = deepCopy(nested)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// convertHPAV1 moves targetCPUUtilizationPercentage into a v2 resource metric
+func convertHPAV1(obj map[string]interface{}) {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	utilization, ok := spec["targetCPUUtilizationPercentage"]
+	if !ok {
+		return
+	}
+	delete(spec, "targetCPUUtilizationPercentage")
+	spec["metrics"] = []interface{}{
+		map[string]interface{}{
+			"type": "Resource",
+			"resource": map[string]interface{}{
+				"name": "cpu",
+				"target": map[string]interface{}{
+					"type":               "Utilization",
+					"averageUtilization": utilization,
+				},
+			},
+		},
+	}
+}
+
+// convertHPAV2beta1 rewrites v2beta1 resource metric targets into v2 targets
+func convertHPAV2beta1(obj map[string]interface{}) {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	metrics, _ := spec["metrics"].([]interface{})
+	for _, metric := range metrics {
+		m, ok := metric.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resource, ok := m["resource"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if utilization, ok := resource["targetAverageUtilization"]; ok {
+			delete(resource, "targetAverageUtilization")
+			resource["target"] = map[string]interface{}{"type": "Utilization", "averageUtilization": utilization}
+		} else if value, ok := resource["targetAverageValue"]; ok {
+			delete(resource, "targetAverageValue")
+			resource["target"] = map[string]interface{}{"type": "AverageValue", "averageValue": value}
+		}
+	}
+}
+
+// convertIngressV1beta1 rewrites v1beta1 backends (serviceName/servicePort) into
+// v1 service backends, renames spec.backend to spec.defaultBackend and fills in
+// the pathType v1beta1 defaulted to
+func convertIngressV1beta1(obj map[string]interface{}) {
+	spec, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if backend, ok := spec["backend"].(map[string]interface{}); ok {
+		delete(spec, "backend")
+		spec["defaultBackend"] = convertIngressBackend(backend)
+	}
+
+	rules, _ := spec["rules"].([]interface{})
+	for _, rule := range rules {
+		r, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		http, ok := r["http"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _ := http["paths"].([]interface{})
+		for _, path := range paths {
+			p, ok := path.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if backend, ok := p["backend"].(map[string]interface{}); ok {
+				p["backend"] = convertIngressBackend(backend)
+			}
+			if _, ok := p["pathType"]; !ok {
+				p["pathType"] = "ImplementationSpecific"
+			}
+		}
+	}
+}
+
+// convertIngressBackend converts a v1beta1 Ingress backend to a v1 backend
+func convertIngressBackend(backend map[string]interface{}) map[string]interface{} {
+	name, hasName := backend["serviceName"]
+	if !hasName {
+		return backend
+	}
+
+	port := map[string]interface{}{}
+	switch servicePort := backend["servicePort"].(type) {
+	case string:
+		port["name"] = servicePort
+	case nil:
+	default:
+		port["number"] = servicePort
+	}
+
+	converted := map[string]interface{}{
+		"service": map[string]interface{}{
+			"name": name,
+			"port": port,
+		},
+	}
+	for key, value := range backend {
+		if key != "serviceName" && key != "servicePort" {
+			converted[key] = value
+		}
+	}
+	return converted
+}
@@ -0,0 +1,264 @@
+package k8s
+
+import "strings"
+
+// The defaults below follow the upstream defaulting funcs (SetDefaults_* in
+// k8s.io/kubernetes/pkg/apis/{core,apps,batch}/v1) for the fields that commonly
+// show up as noise. They are applied as the API server would when an object
+// is created; defaults that depend on cluster state are left out.
+
+// defaulters apply the defaults of a kind, keyed by group/kind
+var defaulters = map[string]func(spec map[string]interface{}){
+	"core/Pod":     defaultPodSpec,
+	"core/Service": defaultServiceSpec,
+	"core/ReplicationController": func(spec map[string]interface{}) {
+		setDefault(spec, "replicas", 1)
+		defaultPodTemplate(spec)
+	},
+	"apps/Deployment":  defaultDeploymentSpec,
+	"apps/StatefulSet": defaultStatefulSetSpec,
+	"apps/DaemonSet":   defaultDaemonSetSpec,
+	"apps/ReplicaSet": func(spec map[string]interface{}) {
+		setDefault(spec, "replicas", 1)
+		defaultPodTemplate(spec)
+	},
+	"batch/Job":     defaultJobSpec,
+	"batch/CronJob": defaultCronJobSpec,
+}
+
+// WithDefaults returns a copy of obj with the defaults the API server would
+// set filled in, or obj itself if its kind has no known defaults
+func WithDefaults(obj map[string]interface{}) map[string]interface{} {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	group, _ := SplitAPIVersion(apiVersion)
+	defaulter, ok := defaulters[CanonicalGroup(group, kind)+"/"+kind]
+	if !ok {
+		return obj
+	}
+
+	defaulted := deepCopy(obj).(map[string]interface{})
+	if spec, ok := defaulted["spec"].(map[string]interface{}); ok {
+		defaulter(spec)
+	}
+	return defaulted
+}
+
+// setDefault sets key to value unless it is already set
+func setDefault(m map[string]interface{}, key string, value interface{}) {
+	if _, ok := m[key]; !ok {
+		m[key] = value
+	}
+}
+
+// nestedMap returns the map at key, creating it if create is set and it is absent
+func nestedMap(m map[string]interface{}, key string, create bool) (map[string]interface{}, bool) {
+	if nested, ok := m[key].(map[string]interface{}); ok {
+		return nested, true
+	}
+	if _, ok := m[key]; ok || !create {
+		return nil, false
+	}
+	nested := map[string]interface{}{}
+	m[key] = nested
+	return nested, true
+}
+
+// eachMap calls fn for every map in the list at key
+func eachMap(m map[string]interface{}, key string, fn func(map[string]interface{})) {
+	list, _ := m[key].([]interface{})
+	for _, item := range list {
+		if item, ok := item.(map[string]interface{}); ok {
+			fn(item)
+		}
+	}
+}
+
+// defaultPodTemplate defaults the pod spec of spec.template
+func defaultPodTemplate(spec map[string]interface{}) {
+	if template, ok := nestedMap(spec, "template", false); ok {
+		if podSpec, ok := nestedMap(template, "spec", false); ok {
+			defaultPodSpec(podSpec)
+		}
+	}
+}
+
+// defaultPodSpec applies SetDefaults_PodSpec and the defaults of containers,
+// probes and volumes
+func defaultPodSpec(spec map[string]interface{}) {
+	setDefault(spec, "restartPolicy", "Always")
+	setDefault(spec, "dnsPolicy", "ClusterFirst")
+	setDefault(spec, "terminationGracePeriodSeconds", 30)
+	setDefault(spec, "schedulerName", "default-scheduler")
+	setDefault(spec, "securityContext", map[string]interface{}{})
+	setDefault(spec, "enableServiceLinks", true)
+
+	for _, key := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		eachMap(spec, key, defaultContainer)
+	}
+	eachMap(spec, "volumes", defaultVolume)
+}
+
+// defaultContainer applies SetDefaults_Container and the defaults of its
+// ports, probes and environment
+func defaultContainer(container map[string]interface{}) {
+	setDefault(container, "terminationMessagePath", "/dev/termination-log")
+	setDefault(container, "terminationMessagePolicy", "File")
+	if image, ok := container["image"].(string); ok {
+		setDefault(container, "imagePullPolicy", defaultPullPolicy(image))
+	}
+
+	eachMap(container, "ports", func(port map[string]interface{}) {
+		setDefault(port, "protocol", "TCP")
+	})
+	for _, key := range []string{"livenessProbe", "readinessProbe", "startupProbe"} {
+		if probe, ok := nestedMap(container, key, false); ok {
+			defaultProbe(probe)
+		}
+	}
+	eachMap(container, "env", func(env map[string]interface{}) {
+		if valueFrom, ok := nestedMap(env, "valueFrom", false); ok {
+			if fieldRef, ok := nestedMap(valueFrom, "fieldRef", false); ok {
+				setDefault(fieldRef, "apiVersion", "v1")
+			}
+		}
+	})
+}
+
+// defaultPullPolicy returns Always for images without a tag or tagged latest,
+// and IfNotPresent otherwise
+func defaultPullPolicy(image string) string {
+	if strings.Contains(image, "@") {
+		return "IfNotPresent"
+	}
+	// The tag follows the last ":" after the last "/", which may be a registry port
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i < 0 || name[i+1:] == "latest" {
+		return "Always"
+	}
+	return "IfNotPresent"
+}
+
+// defaultProbe applies SetDefaults_Probe and the HTTP scheme default
+func defaultProbe(probe map[string]interface{}) {
+	setDefault(probe, "timeoutSeconds", 1)
+	setDefault(probe, "periodSeconds", 10)
+	setDefault(probe, "successThreshold", 1)
+	setDefault(probe, "failureThreshold", 3)
+	if httpGet, ok := nestedMap(probe, "httpGet", false); ok {
+		setDefault(httpGet, "path", "/")
+		setDefault(httpGet, "scheme", "HTTP")
+	}
+}
+
+// defaultVolume applies the defaults of volume sources
+func defaultVolume(volume map[string]interface{}) {
+	for _, key := range []string{"configMap", "secret", "projected", "downwardAPI"} {
+		if source, ok := nestedMap(volume, key, false); ok {
+			setDefault(source, "defaultMode", 0o644)
+		}
+	}
+	if hostPath, ok := nestedMap(volume, "hostPath", false); ok {
+		setDefault(hostPath, "type", "")
+	}
+}
+
+// defaultServiceSpec applies SetDefaults_Service
+func defaultServiceSpec(spec map[string]interface{}) {
+	setDefault(spec, "type", "ClusterIP")
+	setDefault(spec, "sessionAffinity", "None")
+	serviceType, _ := spec["type"].(string)
+	if serviceType != "ExternalName" {
+		setDefault(spec, "internalTrafficPolicy", "Cluster")
+	}
+	if serviceType == "NodePort" || serviceType == "LoadBalancer" {
+		setDefault(spec, "externalTrafficPolicy", "Cluster")
+	}
+
+	eachMap(spec, "ports", func(port map[string]interface{}) {
+		setDefault(port, "protocol", "TCP")
+		if value, ok := port["port"]; ok {
+			setDefault(port, "targetPort", value)
+		}
+	})
+}
+
+// defaultDeploymentSpec applies SetDefaults_Deployment
+func defaultDeploymentSpec(spec map[string]interface{}) {
+	setDefault(spec, "replicas", 1)
+	setDefault(spec, "revisionHistoryLimit", 10)
+	setDefault(spec, "progressDeadlineSeconds", 600)
+	if strategy, ok := nestedMap(spec, "strategy", true); ok {
+		setDefault(strategy, "type", "RollingUpdate")
+		if strategy["type"] == "RollingUpdate" {
+			if rollingUpdate, ok := nestedMap(strategy, "rollingUpdate", true); ok {
+				setDefault(rollingUpdate, "maxUnavailable", "25%")
+				setDefault(rollingUpdate, "maxSurge", "25%")
+			}
+		}
+	}
+	defaultPodTemplate(spec)
+}
+
+// defaultStatefulSetSpec applies SetDefaults_StatefulSet
+func defaultStatefulSetSpec(spec map[string]interface{}) {
+	setDefault(spec, "replicas", 1)
+	setDefault(spec, "podManagementPolicy", "OrderedReady")
+	setDefault(spec, "revisionHistoryLimit", 10)
+	if strategy, ok := nestedMap(spec, "updateStrategy", true); ok {
+		setDefault(strategy, "type", "RollingUpdate")
+		if strategy["type"] == "RollingUpdate" {
+			if rollingUpdate, ok := nestedMap(strategy, "rollingUpdate", true); ok {
+				setDefault(rollingUpdate, "partition", 0)
+			}
+		}
+	}
+	if policy, ok := nestedMap(spec, "persistentVolumeClaimRetentionPolicy", true); ok {
+		setDefault(policy, "whenDeleted", "Retain")
+		setDefault(policy, "whenScaled", "Retain")
+	}
+	defaultPodTemplate(spec)
+}
+
+// defaultDaemonSetSpec applies SetDefaults_DaemonSet
+func defaultDaemonSetSpec(spec map[string]interface{}) {
+	setDefault(spec, "revisionHistoryLimit", 10)
+	if strategy, ok := nestedMap(spec, "updateStrategy", true); ok {
+		setDefault(strategy, "type", "RollingUpdate")
+		if strategy["type"] == "RollingUpdate" {
+			if rollingUpdate, ok := nestedMap(strategy, "rollingUpdate", true); ok {
+				setDefault(rollingUpdate, "maxUnavailable", 1)
+				setDefault(rollingUpdate, "maxSurge", 0)
+			}
+		}
+	}
+	defaultPodTemplate(spec)
+}
+
+// defaultJobSpec applies SetDefaults_Job
+func defaultJobSpec(spec map[string]interface{}) {
+	_, hasCompletions := spec["completions"]
+	_, hasParallelism := spec["parallelism"]
+	if !hasCompletions && !hasParallelism {
+		spec["completions"] = 1
+		spec["parallelism"] = 1
+	}
+	setDefault(spec, "parallelism", 1)
+	setDefault(spec, "backoffLimit", 6)
+	setDefault(spec, "completionMode", "NonIndexed")
+	setDefault(spec, "suspend", false)
+	defaultPodTemplate(spec)
+}
+
+// defaultCronJobSpec applies SetDefaults_CronJob and defaults its job template
+func defaultCronJobSpec(spec map[string]interface{}) {
+	setDefault(spec, "concurrencyPolicy", "Allow")
+	setDefault(spec, "suspend", false)
+	setDefault(spec, "successfulJobsHistoryLimit", 3)
+	setDefault(spec, "failedJobsHistoryLimit", 1)
+	if jobTemplate, ok := nestedMap(spec, "jobTemplate", false); ok {
+		if jobSpec, ok := nestedMap(jobTemplate, "spec", false); ok {
+			defaultJobSpec(jobSpec)
+		}
+	}
+}
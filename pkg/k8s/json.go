@@ -0,0 +1,139 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// looksLikeJSON reports whether data starts with a JSON object or array
+func looksLikeJSON(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// decodeJSONDocuments decodes a stream of concatenated JSON values. Objects are
+// documents of their own and arrays hold one object per element, like the
+// items of a List. Numbers are decoded the way YAML decodes them (int when
+// integral, float64 otherwise) so both formats produce identical objects.
+func decodeJSONDocuments(data []byte, opts ParseOptions) ([]parsedObject, error) {
+	var objects []parsedObject
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	for document := 1; ; document++ {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode JSON %s: %w", Source{File: opts.File, Document: document}, err)
+		}
+
+		start := int(decoder.InputOffset()) - len(raw)
+		node := jsonNode(data, start, raw)
+		source := Source{File: opts.File, Document: document}
+		source.Line, source.Column = position(data, start)
+
+		var value interface{}
+		if err := unmarshalJSON(raw, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON %s: %w", source, err)
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			objects = append(objects, parsedObject{obj: value, node: node, source: source})
+		case []interface{}:
+			for i, item := range value {
+				obj, ok := item.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("item %d of JSON array at %s is not an object", i, source)
+				}
+				itemSource := source
+				var itemNode *yaml.Node
+				if node != nil && node.Kind == yaml.SequenceNode && i < len(node.Content) {
+					itemNode = node.Content[i]
+					itemSource.Line, itemSource.Column = itemNode.Line, itemNode.Column
+				}
+				objects = append(objects, parsedObject{obj: obj, node: itemNode, source: itemSource})
+			}
+		case nil:
+		default:
+			return nil, fmt.Errorf("JSON %s is not an object or array", source)
+		}
+	}
+
+	return objects, nil
+}
+
+// unmarshalJSON decodes JSON, converting numbers to int or float64
+func unmarshalJSON(raw []byte, value *interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(value); err != nil {
+		return err
+	}
+	*value = convertNumbers(*value)
+	return nil
+}
+
+// convertNumbers replaces json.Number values with int or float64
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = convertNumbers(nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = convertNumbers(nested)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil && int64(int(i)) == i {
+			return int(i)
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return value
+}
+
+// jsonNode parses a JSON value as YAML to get the positions of its fields,
+// shifted to where the value starts in data. JSON that YAML cannot read
+// (e.g. the "\/" escape) has no node, so only the object itself can be located.
+func jsonNode(data []byte, start int, raw []byte) *yaml.Node {
+	var document yaml.Node
+	if err := yaml.Unmarshal(raw, &document); err != nil || len(document.Content) == 0 {
+		return nil
+	}
+
+	line, column := position(data, start)
+	shiftNode(document.Content[0], line-1, column-1)
+	return document.Content[0]
+}
+
+// shiftNode moves the positions of a node tree that was parsed on its own to
+// where it starts in the enclosing input
+func shiftNode(node *yaml.Node, lines, columns int) {
+	if node.Line == 1 {
+		node.Column += columns
+	}
+	node.Line += lines
+	for _, child := range node.Content {
+		shiftNode(child, lines, columns)
+	}
+}
+
+// position returns the 1-based line and column of an offset in data
+func position(data []byte, offset int) (line, column int) {
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = offset - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
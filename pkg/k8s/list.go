@@ -0,0 +1,69 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parsedObject is an object decoded from a stream along with its node and source
+type parsedObject struct {
+	obj    map[string]interface{}
+	node   *yaml.Node
+	source Source
+}
+
+// isList reports whether obj is a `kind: List` (or any *List kind such as
+// DeploymentList) wrapping other objects in items, as printed by `kubectl get -o yaml`
+func isList(obj map[string]interface{}) bool {
+	kind, _ := obj["kind"].(string)
+	_, hasItems := obj["items"]
+	return hasItems && strings.HasSuffix(kind, "List")
+}
+
+// expandList returns the items of a List as individual objects. Items must have
+// their own apiVersion and kind, and may not be Lists themselves.
+func expandList(list parsedObject) ([]parsedObject, error) {
+	kind := list.obj["kind"]
+	if list.obj["items"] == nil {
+		return nil, nil
+	}
+	items, ok := list.obj["items"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s at %s: items is not a list", kind, list.source)
+	}
+
+	var itemNodes []*yaml.Node
+	if itemsNode, _, ok := findChild(list.node, "items"); ok && itemsNode.Kind == yaml.SequenceNode {
+		itemNodes = itemsNode.Content
+	}
+
+	var objects []parsedObject
+	for i, item := range items {
+		source := list.source
+		var node *yaml.Node
+		if i < len(itemNodes) {
+			node = itemNodes[i]
+			source.Line = node.Line
+			source.Column = node.Column
+		}
+
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("item %d of %s at %s is not an object", i, kind, source)
+		}
+		if apiVersion, ok := obj["apiVersion"].(string); !ok || apiVersion == "" {
+			return nil, fmt.Errorf("item %d of %s at %s: missing or invalid apiVersion", i, kind, source)
+		}
+		if itemKind, ok := obj["kind"].(string); !ok || itemKind == "" {
+			return nil, fmt.Errorf("item %d of %s at %s: missing or invalid kind", i, kind, source)
+		}
+		if isList(obj) {
+			return nil, fmt.Errorf("item %d of %s at %s: nested %s is not supported", i, kind, source, obj["kind"])
+		}
+
+		objects = append(objects, parsedObject{obj: obj, node: node, source: source})
+	}
+	return objects, nil
+}
@@ -0,0 +1,184 @@
+package k8s
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is a set of parsed objects keyed by GenerateObjectKey, together with
+// where each object was read from
+type Manifest struct {
+	Objects map[string]map[string]interface{}
+	Sources map[string]Source
+	// Nodes holds the YAML node each object was decoded from, used to locate
+	// fields within the source
+	Nodes map[string]*yaml.Node
+	// Warnings collects problems that did not stop parsing, such as duplicate
+	// objects under DuplicateWarn
+	Warnings []error
+	// Scopes are the scopes objects were keyed with: the built-in kinds and the
+	// CustomResourceDefinitions of the inputs, or those passed to Rekey
+	Scopes Scopes
+
+	// parsed holds the objects read by ParseManifests before namespaces were
+	// injected, keys their keys and opts the options, for Rekey
+	parsed []parsedObject
+	keys   []string
+	opts   ParseOptions
+}
+
+// Source identifies where an object was read from
+type Source struct {
+	// File is the name of the file or input the object was read from, if known
+	File string `json:"file,omitempty"`
+	// Document is the 1-based position of the YAML document in the stream
+	Document int `json:"document"`
+	// Line and Column are the 1-based position of the object or field
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+	// Hook lists the Helm hook events of an object rendered from a chart, comma
+	// separated as in the helm.sh/hook annotation (e.g. "pre-install,pre-upgrade"
+	// or "test"); empty for regular objects
+	Hook string `json:"hook,omitempty"`
+}
+
+// String formats the source as "file:line (document N)"
+func (s Source) String() string {
+	location := s.File
+	if s.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, s.Line)
+	}
+	if location == "" {
+		return fmt.Sprintf("document %d", s.Document)
+	}
+	return fmt.Sprintf("%s (document %d)", location, s.Document)
+}
+
+// DuplicatePolicy selects what happens when two objects in a stream have the same key
+type DuplicatePolicy string
+
+const (
+	// DuplicateError fails parsing with a *DuplicateObjectError
+	DuplicateError DuplicatePolicy = "error"
+	// DuplicateWarn keeps the last object and records a *DuplicateObjectError in Manifest.Warnings
+	DuplicateWarn DuplicatePolicy = "warn"
+	// DuplicateLastWins silently keeps the last object
+	DuplicateLastWins DuplicatePolicy = "last-wins"
+)
+
+// ParseDuplicatePolicy validates a duplicate policy name
+func ParseDuplicatePolicy(name string) (DuplicatePolicy, error) {
+	switch policy := DuplicatePolicy(name); policy {
+	case DuplicateError, DuplicateWarn, DuplicateLastWins:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown duplicate policy %q (expected error, warn or last-wins)", name)
+	}
+}
+
+// DuplicateObjectError reports two objects with the same key
+type DuplicateObjectError struct {
+	Key    string
+	First  Source
+	Second Source
+}
+
+// Error implements error
+func (e *DuplicateObjectError) Error() string {
+	return fmt.Sprintf("duplicate object %s in %s and %s", e.Key, e.First, e.Second)
+}
+
+// NewManifest returns an empty manifest
+func NewManifest() *Manifest {
+	return &Manifest{
+		Objects: make(map[string]map[string]interface{}),
+		Sources: make(map[string]Source),
+		Nodes:   make(map[string]*yaml.Node),
+	}
+}
+
+// Add adds an object under key, applying policy if the key is already taken.
+// node is the YAML node the object was decoded from, or nil if unknown.
+func (m *Manifest) Add(key string, obj map[string]interface{}, node *yaml.Node, source Source, policy DuplicatePolicy) error {
+	if first, exists := m.Sources[key]; exists {
+		duplicate := &DuplicateObjectError{Key: key, First: first, Second: source}
+		switch policy {
+		case DuplicateWarn:
+			m.Warnings = append(m.Warnings, duplicate)
+		case DuplicateLastWins:
+		default:
+			return duplicate
+		}
+	}
+
+	m.Objects[key] = obj
+	m.Sources[key] = source
+	if node != nil {
+		m.Nodes[key] = node
+	} else {
+		delete(m.Nodes, key)
+	}
+	return nil
+}
+
+// Locate returns the source of a field of the object with the given key. The
+// path holds map keys (strings), list indices (ints) and list elements selected
+// by merge key (single-entry maps such as {"name": "app"}); an empty path
+// locates the object itself.
+func (m *Manifest) Locate(key string, path []interface{}) (Source, bool) {
+	source, ok := m.Sources[key]
+	node := m.Nodes[key]
+	if !ok || node == nil {
+		return Source{}, false
+	}
+
+	position := node
+	for _, element := range path {
+		var found bool
+		node, position, found = findChild(node, element)
+		if !found {
+			return Source{}, false
+		}
+	}
+
+	source.Line = position.Line
+	source.Column = position.Column
+	return source, true
+}
+
+// findChild returns the node for one path element below node, and the node
+// whose position best marks it: the key of a map entry, or the list element
+func findChild(node *yaml.Node, element interface{}) (child, position *yaml.Node, found bool) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch element := element.(type) {
+	case string:
+		if node.Kind != yaml.MappingNode {
+			return nil, nil, false
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == element {
+				return node.Content[i+1], node.Content[i], true
+			}
+		}
+	case int:
+		if node.Kind == yaml.SequenceNode && element >= 0 && element < len(node.Content) {
+			return node.Content[element], node.Content[element], true
+		}
+	case map[string]interface{}:
+		if node.Kind != yaml.SequenceNode {
+			return nil, nil, false
+		}
+		for match, value := range element {
+			for _, item := range node.Content {
+				if field, _, ok := findChild(item, match); ok && field.Kind == yaml.ScalarNode && field.Value == fmt.Sprint(value) {
+					return item, item, true
+				}
+			}
+		}
+	}
+	return nil, nil, false
+}
@@ -1,46 +1,257 @@
 package k8s
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"maps"
 
 	"gopkg.in/yaml.v3"
 )
 
+// ParseOptions controls how a stream of manifests is parsed
+type ParseOptions struct {
+	// DefaultNamespace is set as metadata.namespace on namespaced objects that
+	// have none, like `kubectl apply -n`. When empty, such objects are keyed
+	// under "default" and left as they are.
+	DefaultNamespace string
+	// File names the input in error messages and object sources
+	File string
+	// Duplicates selects what happens when two objects have the same key.
+	// The zero value is DuplicateError.
+	Duplicates DuplicatePolicy
+	// ServerFields selects when fields populated by the API server are removed;
+	// see StripServerFields. The zero value is ServerFieldsAuto.
+	ServerFields ServerFieldsPolicy
+}
+
 // ParseYAMLStream parses a multi-document YAML stream and returns a map of K8s objects
-// keyed by their unique identifier (apiVersion/kind/namespace/name)
+// keyed by their unique identifier (group/kind/namespace/name). CustomResourceDefinitions
+// in the stream extend the built-in table of cluster-scoped kinds.
 func ParseYAMLStream(reader io.Reader) (map[string]map[string]interface{}, error) {
-	objects := make(map[string]map[string]interface{})
-	decoder := yaml.NewDecoder(reader)
+	return ParseYAMLStreamWithOptions(reader, ParseOptions{})
+}
 
-	for {
-		var obj map[string]interface{}
-		err := decoder.Decode(&obj)
-		if err == io.EOF {
-			break
+// ParseYAMLStreamWithOptions parses a multi-document YAML stream like ParseYAMLStream
+// using the given options
+func ParseYAMLStreamWithOptions(reader io.Reader, opts ParseOptions) (map[string]map[string]interface{}, error) {
+	manifest, err := ParseManifest(reader, opts)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Objects, nil
+}
+
+// Input is a named stream of manifests
+type Input struct {
+	// Name identifies the input in error messages and object sources, e.g. a file path
+	Name   string
+	Reader io.Reader
+}
+
+// ParseManifest parses a stream of manifests into a Manifest, recording where
+// each object came from. The stream may hold YAML documents, or concatenated
+// JSON objects and arrays of objects; the format is detected from the content.
+// Lists (`kind: List` and other *List kinds) are expanded into their items.
+func ParseManifest(reader io.Reader, opts ParseOptions) (*Manifest, error) {
+	return ParseManifests([]Input{{Name: opts.File, Reader: reader}}, opts)
+}
+
+// ParseManifests parses several inputs into one Manifest, as if they were a
+// single stream: CustomResourceDefinitions in any input set the scope of custom
+// resources in all of them, and opts.Duplicates applies to objects with the
+// same key in different inputs. Each object's source names its input;
+// opts.File is ignored.
+func ParseManifests(inputs []Input, opts ParseOptions) (*Manifest, error) {
+	var objects []parsedObject
+	for _, input := range inputs {
+		inputOpts := opts
+		inputOpts.File = input.Name
+		parsed, err := decodeObjects(input.Reader, inputOpts)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, parsed...)
+	}
+
+	if stripServerFields(objects, opts.ServerFields) {
+		for _, parsed := range objects {
+			StripServerFields(parsed.obj)
+		}
+	}
+
+	scopes := NewScopes()
+	for _, parsed := range objects {
+		scopes.AddCRD(parsed.obj)
+	}
+
+	// Key objects once all CRDs are known, since a CRD may follow its resources
+	manifest := NewManifest()
+	manifest.parsed = objects
+	manifest.opts = opts
+	sources := make([]Source, len(objects))
+	nodes := make([]*yaml.Node, len(objects))
+	for i, parsed := range objects {
+		sources[i], nodes[i] = parsed.source, parsed.node
+	}
+	if err := manifest.key(scopes, sources, nodes); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Rekey keys the objects of a manifest read by ParseManifests again with
+// scopes, e.g. the merged scopes of both sides of a diff, so that a custom
+// resource whose CRD is on one side only gets the same key on both. Sources
+// and nodes stay with their objects, including those changed after parsing.
+func (m *Manifest) Rekey(scopes Scopes) error {
+	if m.parsed == nil || maps.Equal(m.Scopes, scopes) {
+		return nil
+	}
+
+	rekeyed := NewManifest()
+	rekeyed.parsed = m.parsed
+	rekeyed.opts = m.opts
+	sources := make([]Source, len(m.parsed))
+	nodes := make([]*yaml.Node, len(m.parsed))
+	for i, key := range m.keys {
+		sources[i], nodes[i] = m.Sources[key], m.Nodes[key]
+	}
+	if err := rekeyed.key(scopes, sources, nodes); err != nil {
+		return err
+	}
+	*m = *rekeyed
+	return nil
+}
+
+// key adds the parsed objects of a manifest under their keys in scopes, with
+// the given sources and nodes
+func (m *Manifest) key(scopes Scopes, sources []Source, nodes []*yaml.Node) error {
+	m.Scopes = scopes
+	m.keys = make([]string, len(m.parsed))
+	for i, parsed := range m.parsed {
+		obj := parsed.obj
+		if m.opts.DefaultNamespace != "" {
+			obj = injectNamespace(obj, m.opts.DefaultNamespace, scopes)
 		}
+
+		key, err := generateObjectKey(obj, scopes)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode YAML document: %w", err)
+			return fmt.Errorf("failed to generate object key for %s: %w", parsed.source, err)
 		}
+		m.keys[i] = key
 
-		if len(obj) == 0 {
-			continue
+		if err := m.Add(key, obj, nodes[i], sources[i], m.opts.Duplicates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripServerFields decides whether server fields are removed from objects
+func stripServerFields(objects []parsedObject, policy ServerFieldsPolicy) bool {
+	switch policy {
+	case ServerFieldsStrip:
+		return true
+	case ServerFieldsKeep:
+		return false
+	}
+	for _, parsed := range objects {
+		if LooksLikeClusterExport(parsed.obj) {
+			return true
 		}
+	}
+	return false
+}
 
-		key, err := GenerateObjectKey(obj)
+// decodeObjects reads a YAML or JSON stream and returns its objects, with Lists
+// expanded into their items
+func decodeObjects(reader io.Reader, opts ParseOptions) ([]parsedObject, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", opts.File, err)
+	}
+
+	var documents []parsedObject
+	if looksLikeJSON(data) {
+		documents, err = decodeJSONDocuments(data, opts)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate object key: %w", err)
+			// A YAML flow mapping also starts with "{"
+			if yamlDocuments, yamlErr := decodeYAMLDocuments(data, opts); yamlErr == nil {
+				documents, err = yamlDocuments, nil
+			}
 		}
+	} else {
+		documents, err = decodeYAMLDocuments(data, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-		objects[key] = obj
+	var objects []parsedObject
+	for _, parsed := range documents {
+		if !isList(parsed.obj) {
+			objects = append(objects, parsed)
+			continue
+		}
+
+		items, err := expandList(parsed)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, items...)
 	}
 
 	return objects, nil
 }
 
+// decodeYAMLDocuments decodes the non-empty documents of a YAML stream
+func decodeYAMLDocuments(data []byte, opts ParseOptions) ([]parsedObject, error) {
+	var documents []parsedObject
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	for document := 1; ; document++ {
+		// Decode into a node first so positions are kept
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode YAML %s: %w", Source{File: opts.File, Document: document}, err)
+		}
+
+		var obj map[string]interface{}
+		if err := node.Decode(&obj); err != nil {
+			return nil, fmt.Errorf("failed to decode YAML %s: %w", Source{File: opts.File, Document: document}, err)
+		}
+
+		if len(obj) == 0 {
+			continue
+		}
+
+		root := node.Content[0]
+		documents = append(documents, parsedObject{
+			obj:    obj,
+			node:   root,
+			source: Source{File: opts.File, Document: document, Line: root.Line, Column: root.Column},
+		})
+	}
+
+	return documents, nil
+}
+
 // GenerateObjectKey creates a unique identifier for a K8s object
-// Format: apiVersion/kind/namespace/name (uses "default" when namespace not specified)
+// Format: group/kind/namespace/name (uses "default" when namespace not specified).
+// The version is left out so that an object keeps its key when it migrates to a
+// new API version; the core group is written as "core". Cluster-scoped kinds
+// have an empty namespace.
 func GenerateObjectKey(obj map[string]interface{}) (string, error) {
+	return generateObjectKey(obj, NewScopes())
+}
+
+// generateObjectKey creates the key of an object, looking up its scope in scopes
+func generateObjectKey(obj map[string]interface{}, scopes Scopes) (string, error) {
 	apiVersion, ok := obj["apiVersion"].(string)
 	if !ok || apiVersion == "" {
 		return "", fmt.Errorf("missing or invalid apiVersion")
@@ -61,10 +272,40 @@ func GenerateObjectKey(obj map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("missing or invalid metadata.name")
 	}
 
+	group, _ := SplitAPIVersion(apiVersion)
+
 	namespace := "default"
-	if ns, ok := metadata["namespace"].(string); ok && ns != "" {
+	if scopes.IsClusterScoped(group, kind) {
+		namespace = ""
+	} else if ns, ok := metadata["namespace"].(string); ok && ns != "" {
 		namespace = ns
 	}
 
-	return fmt.Sprintf("%s/%s/%s/%s", apiVersion, kind, namespace, name), nil
+	return fmt.Sprintf("%s/%s/%s/%s", CanonicalGroup(group, kind), kind, namespace, name), nil
+}
+
+// injectNamespace returns a namespaced object that has no metadata.namespace
+// with namespace set, copying it so the parsed object can be keyed again.
+// Other objects are returned as is.
+func injectNamespace(obj map[string]interface{}, namespace string, scopes Scopes) map[string]interface{} {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return obj
+	}
+	if ns, ok := metadata["namespace"].(string); ok && ns != "" {
+		return obj
+	}
+
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	group, _ := SplitAPIVersion(apiVersion)
+	if scopes.IsClusterScoped(group, kind) {
+		return obj
+	}
+
+	injected := maps.Clone(obj)
+	injectedMetadata := maps.Clone(metadata)
+	injectedMetadata["namespace"] = namespace
+	injected["metadata"] = injectedMetadata
+	return injected
 }
@@ -1,6 +1,8 @@
 package k8s
 
 import (
+	"errors"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -58,12 +60,123 @@ data:
 			expected: 1,
 			wantErr:  false,
 		},
+		{
+			name: "list",
+			yaml: `apiVersion: v1
+kind: List
+metadata:
+  resourceVersion: ""
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: test-config
+    namespace: default
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: test-app
+    namespace: default`,
+			expected: 2,
+			wantErr:  false,
+		},
+		{
+			name: "typed list next to a document",
+			yaml: `apiVersion: v1
+kind: ConfigMapList
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: first
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: second
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: third`,
+			expected: 3,
+			wantErr:  false,
+		},
+		{
+			name: "empty list",
+			yaml: `apiVersion: v1
+kind: List
+items: []`,
+			expected: 0,
+			wantErr:  false,
+		},
+		{
+			name: "nested list",
+			yaml: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: List
+  items: []`,
+			expected: 0,
+			wantErr:  true,
+		},
+		{
+			name: "list item without kind",
+			yaml: `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  metadata:
+    name: test-config`,
+			expected: 0,
+			wantErr:  true,
+		},
 		{
 			name:     "completely empty",
 			yaml:     "",
 			expected: 0,
 			wantErr:  false,
 		},
+		{
+			name:     "json object",
+			yaml:     `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "test-config"}}`,
+			expected: 1,
+			wantErr:  false,
+		},
+		{
+			name: "concatenated json",
+			yaml: `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "first"}}
+{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "second"}}`,
+			expected: 2,
+			wantErr:  false,
+		},
+		{
+			name: "json array",
+			yaml: `[
+  {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "first"}},
+  {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "second"}}
+]`,
+			expected: 2,
+			wantErr:  false,
+		},
+		{
+			name:     "json list",
+			yaml:     `{"apiVersion": "v1", "kind": "List", "items": [{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "first"}}]}`,
+			expected: 1,
+			wantErr:  false,
+		},
+		{
+			name:     "yaml flow mapping",
+			yaml:     `{apiVersion: v1, kind: ConfigMap, metadata: {name: test-config}}`,
+			expected: 1,
+			wantErr:  false,
+		},
+		{
+			name:     "json array of non-objects",
+			yaml:     `[1, 2]`,
+			expected: 0,
+			wantErr:  true,
+		},
 		{
 			name: "invalid yaml",
 			yaml: `apiVersion: v1
@@ -120,7 +233,7 @@ func TestGenerateObjectKey(t *testing.T) {
 					"namespace": "default",
 				},
 			},
-			expected: "v1/ConfigMap/default/test-config",
+			expected: "core/ConfigMap/default/test-config",
 			wantErr:  false,
 		},
 		{
@@ -132,7 +245,58 @@ func TestGenerateObjectKey(t *testing.T) {
 					"name": "test-config",
 				},
 			},
-			expected: "v1/ConfigMap/default/test-config",
+			expected: "core/ConfigMap/default/test-config",
+			wantErr:  false,
+		},
+		{
+			name: "grouped resource",
+			object: map[string]interface{}{
+				"apiVersion": "autoscaling/v2",
+				"kind":       "HorizontalPodAutoscaler",
+				"metadata": map[string]interface{}{
+					"name":      "web",
+					"namespace": "prod",
+				},
+			},
+			expected: "autoscaling/HorizontalPodAutoscaler/prod/web",
+			wantErr:  false,
+		},
+		{
+			name: "kind moved out of legacy group",
+			object: map[string]interface{}{
+				"apiVersion": "extensions/v1beta1",
+				"kind":       "Ingress",
+				"metadata": map[string]interface{}{
+					"name":      "web",
+					"namespace": "prod",
+				},
+			},
+			expected: "networking.k8s.io/Ingress/prod/web",
+			wantErr:  false,
+		},
+		{
+			name: "cluster-scoped core resource",
+			object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Namespace",
+				"metadata": map[string]interface{}{
+					"name": "team-a",
+				},
+			},
+			expected: "core/Namespace//team-a",
+			wantErr:  false,
+		},
+		{
+			name: "cluster-scoped resource with namespace set",
+			object: map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "ClusterRole",
+				"metadata": map[string]interface{}{
+					"name":      "reader",
+					"namespace": "ignored",
+				},
+			},
+			expected: "rbac.authorization.k8s.io/ClusterRole//reader",
 			wantErr:  false,
 		},
 		{
@@ -202,3 +366,693 @@ func TestGenerateObjectKey(t *testing.T) {
 		})
 	}
 }
+
+func TestParseYAMLStreamScopes(t *testing.T) {
+	yaml := `apiVersion: example.com/v1
+kind: Tenant
+metadata:
+  name: acme
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gear
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: tenants.example.com
+spec:
+  group: example.com
+  scope: Cluster
+  names:
+    kind: Tenant
+    plural: tenants
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    kind: Widget
+    plural: widgets`
+
+	objects, err := ParseYAMLStream(strings.NewReader(yaml))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"example.com/Tenant//acme",
+		"example.com/Widget/default/gear",
+		"apiextensions.k8s.io/CustomResourceDefinition//tenants.example.com",
+		"apiextensions.k8s.io/CustomResourceDefinition//widgets.example.com",
+	}
+	if len(objects) != len(expected) {
+		t.Errorf("expected %d objects, got %d", len(expected), len(objects))
+	}
+	for _, key := range expected {
+		if _, exists := objects[key]; !exists {
+			t.Errorf("expected object %s not found", key)
+		}
+	}
+}
+
+func TestParseYAMLStreamDefaultNamespace(t *testing.T) {
+	yaml := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: implicit
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: explicit
+  namespace: other
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a`
+
+	tests := []struct {
+		name      string
+		namespace string
+		expected  map[string]interface{}
+	}{
+		{
+			name: "no default namespace",
+			expected: map[string]interface{}{
+				"core/ConfigMap/default/implicit": nil,
+				"core/ConfigMap/other/explicit":   "other",
+				"core/Namespace//team-a":          nil,
+			},
+		},
+		{
+			name:      "default namespace",
+			namespace: "team-a",
+			expected: map[string]interface{}{
+				"core/ConfigMap/team-a/implicit": "team-a",
+				"core/ConfigMap/other/explicit":  "other",
+				"core/Namespace//team-a":         nil,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := ParseYAMLStreamWithOptions(strings.NewReader(yaml), ParseOptions{DefaultNamespace: tt.namespace})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(objects) != len(tt.expected) {
+				t.Errorf("expected %d objects, got %d", len(tt.expected), len(objects))
+			}
+			for key, namespace := range tt.expected {
+				obj, exists := objects[key]
+				if !exists {
+					t.Errorf("expected object %s not found", key)
+					continue
+				}
+				metadata := obj["metadata"].(map[string]interface{})
+				if metadata["namespace"] != namespace {
+					t.Errorf("expected %s to have metadata.namespace %v, got %v", key, namespace, metadata["namespace"])
+				}
+			}
+		})
+	}
+}
+
+func TestManifestRekey(t *testing.T) {
+	widget := `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: gear
+`
+	crd := `---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  scope: Cluster
+  names:
+    kind: Widget
+    plural: widgets
+`
+
+	// The CRD is only in after, so before takes the Widget to be namespaced
+	opts := ParseOptions{File: "before.yaml", DefaultNamespace: "team-a"}
+	before, err := ParseManifest(strings.NewReader(widget), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts.File = "after.yaml"
+	after, err := ParseManifest(strings.NewReader(widget+crd), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, exists := before.Objects["example.com/Widget/team-a/gear"]; !exists {
+		t.Fatalf("expected the Widget to be namespaced before rekeying, got %v", before.Sources)
+	}
+
+	scopes := before.Scopes.Merge(after.Scopes)
+	for _, manifest := range []*Manifest{before, after} {
+		if err := manifest.Rekey(scopes); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	key := "example.com/Widget//gear"
+	for name, manifest := range map[string]*Manifest{"before": before, "after": after} {
+		obj, exists := manifest.Objects[key]
+		if !exists {
+			t.Errorf("expected %s to have %s, got %v", name, key, manifest.Sources)
+			continue
+		}
+		if namespace, ok := obj["metadata"].(map[string]interface{})["namespace"]; ok {
+			t.Errorf("expected no namespace to be injected in %s, got %v", name, namespace)
+		}
+		if source := manifest.Sources[key]; source.File != name+".yaml" || source.Line != 1 {
+			t.Errorf("expected %s to keep its source, got %s", name, source)
+		}
+	}
+	if len(before.Objects) != 1 {
+		t.Errorf("expected before to have 1 object, got %v", before.Sources)
+	}
+}
+
+func TestParseManifestDuplicates(t *testing.T) {
+	yaml := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: first
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: default
+data:
+  mode: second`
+
+	tests := []struct {
+		name     string
+		policy   DuplicatePolicy
+		wantErr  bool
+		warnings int
+	}{
+		{
+			name:    "error by default",
+			wantErr: true,
+		},
+		{
+			name:     "warn",
+			policy:   DuplicateWarn,
+			warnings: 1,
+		},
+		{
+			name:   "last wins",
+			policy: DuplicateLastWins,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ParseOptions{File: "app.yaml", Duplicates: tt.policy}
+			manifest, err := ParseManifest(strings.NewReader(yaml), opts)
+
+			if tt.wantErr {
+				var duplicate *DuplicateObjectError
+				if !errors.As(err, &duplicate) {
+					t.Fatalf("expected DuplicateObjectError, got %v", err)
+				}
+				if duplicate.Key != "core/ConfigMap/default/settings" {
+					t.Errorf("expected duplicate key core/ConfigMap/default/settings, got %s", duplicate.Key)
+				}
+				first := Source{File: "app.yaml", Document: 1, Line: 1, Column: 1}
+				second := Source{File: "app.yaml", Document: 3, Line: 13, Column: 1}
+				if duplicate.First != first || duplicate.Second != second {
+					t.Errorf("expected duplicates in documents 1 and 3, got %s and %s", duplicate.First, duplicate.Second)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(manifest.Warnings) != tt.warnings {
+				t.Errorf("expected %d warnings, got %v", tt.warnings, manifest.Warnings)
+			}
+
+			key := "core/ConfigMap/default/settings"
+			data := manifest.Objects[key]["data"].(map[string]interface{})
+			if data["mode"] != "second" {
+				t.Errorf("expected last object to win, got %v", data["mode"])
+			}
+			if manifest.Sources[key].Document != 3 {
+				t.Errorf("expected source document 3, got %d", manifest.Sources[key].Document)
+			}
+		})
+	}
+}
+
+func TestManifestLocate(t *testing.T) {
+	yaml := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  mode: fast
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: proxy
+        image: envoy
+      - name: app
+        image: nginx
+        args:
+        - --port=80
+        - --verbose`
+
+	manifest, err := ParseManifest(strings.NewReader(yaml), ParseOptions{File: "app.yaml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		path   []interface{}
+		line   int
+		column int
+		found  bool
+	}{
+		{
+			name:   "object",
+			key:    "core/ConfigMap/default/settings",
+			line:   1,
+			column: 1,
+			found:  true,
+		},
+		{
+			name:   "map key",
+			key:    "core/ConfigMap/default/settings",
+			path:   []interface{}{"data", "mode"},
+			line:   6,
+			column: 3,
+			found:  true,
+		},
+		{
+			name:   "selector and index",
+			key:    "apps/Deployment/default/web",
+			path:   []interface{}{"spec", "template", "spec", "containers", map[string]interface{}{"name": "app"}, "args", 1},
+			line:   22,
+			column: 11,
+			found:  true,
+		},
+		{
+			name:  "missing field",
+			key:   "apps/Deployment/default/web",
+			path:  []interface{}{"spec", "replicas"},
+			found: false,
+		},
+		{
+			name:  "missing object",
+			key:   "core/ConfigMap/default/missing",
+			found: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, found := manifest.Locate(tt.key, tt.path)
+			if found != tt.found {
+				t.Fatalf("expected found %v, got %v", tt.found, found)
+			}
+			if !found {
+				return
+			}
+			if source.File != "app.yaml" || source.Line != tt.line || source.Column != tt.column {
+				t.Errorf("expected app.yaml:%d:%d, got %s:%d:%d", tt.line, tt.column, source.File, source.Line, source.Column)
+			}
+		})
+	}
+}
+
+func TestParseManifestListSources(t *testing.T) {
+	yaml := `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: first
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: second
+    namespace: default
+  data:
+    key: value`
+
+	manifest, err := ParseManifest(strings.NewReader(yaml), ParseOptions{File: "dump.yaml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Source{File: "dump.yaml", Document: 1, Line: 8, Column: 3}
+	if source := manifest.Sources["core/ConfigMap/default/second"]; source != expected {
+		t.Errorf("expected source %v, got %v", expected, source)
+	}
+
+	source, found := manifest.Locate("core/ConfigMap/default/second", []interface{}{"data", "key"})
+	if !found || source.Line != 14 {
+		t.Errorf("expected data.key on line 14, got %v (found %v)", source, found)
+	}
+}
+
+func TestParseManifestJSON(t *testing.T) {
+	yamlInput := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    metadata:
+      annotations:
+        ratio: 0.5
+        url: http://example.com/
+`
+	jsonInput := `{
+  "apiVersion": "apps/v1",
+  "kind": "Deployment",
+  "metadata": {"name": "web"},
+  "spec": {
+    "replicas": 3,
+    "template": {"metadata": {"annotations": {"ratio": 0.5, "url": "http:\/\/example.com\/"}}}
+  }
+}`
+
+	expected, err := ParseManifest(strings.NewReader(yamlInput), ParseOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manifest, err := ParseManifest(strings.NewReader(jsonInput), ParseOptions{File: "app.json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	key := "apps/Deployment/default/web"
+	if !reflect.DeepEqual(manifest.Objects[key], expected.Objects[key]) {
+		t.Errorf("expected %v, got %v", expected.Objects[key], manifest.Objects[key])
+	}
+
+	// The "\/" escape cannot be read as YAML, so only the object itself is located
+	if source := manifest.Sources[key]; source != (Source{File: "app.json", Document: 1, Line: 1, Column: 1}) {
+		t.Errorf("unexpected source %v", source)
+	}
+}
+
+func TestParseManifestJSONSources(t *testing.T) {
+	json := `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "first"}}
+[
+  {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "second"}},
+  {
+    "apiVersion": "v1",
+    "kind": "ConfigMap",
+    "metadata": {"name": "third"},
+    "data": {"key": "value"}
+  }
+]`
+
+	manifest, err := ParseManifest(strings.NewReader(json), ParseOptions{File: "dump.json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string]Source{
+		"core/ConfigMap/default/first":  {File: "dump.json", Document: 1, Line: 1, Column: 1},
+		"core/ConfigMap/default/second": {File: "dump.json", Document: 2, Line: 3, Column: 3},
+		"core/ConfigMap/default/third":  {File: "dump.json", Document: 2, Line: 4, Column: 3},
+	}
+	for key, expected := range tests {
+		if source := manifest.Sources[key]; source != expected {
+			t.Errorf("%s: expected source %v, got %v", key, expected, source)
+		}
+	}
+
+	source, found := manifest.Locate("core/ConfigMap/default/third", []interface{}{"data", "key"})
+	if !found || source.Line != 8 {
+		t.Errorf("expected data.key on line 8, got %v (found %v)", source, found)
+	}
+}
+
+func TestParseManifestServerFields(t *testing.T) {
+	export := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: exported
+  uid: abc-123
+  resourceVersion: "12345"
+  generation: 2
+  creationTimestamp: "2024-01-01T00:00:00Z"
+  managedFields:
+  - manager: kubectl
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+    team: payments
+data:
+  key: value
+status:
+  phase: Active
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rendered
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+`
+	rendered := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rendered
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: "{}"
+status:
+  phase: Active
+`
+	stripped := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":        "exported",
+			"annotations": map[string]interface{}{"team": "payments"},
+		},
+		"data": map[string]interface{}{"key": "value"},
+	}
+
+	tests := []struct {
+		name     string
+		yaml     string
+		policy   ServerFieldsPolicy
+		key      string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "auto strips a cluster export",
+			yaml:     export,
+			key:      "core/ConfigMap/default/exported",
+			expected: stripped,
+		},
+		{
+			name:     "auto strips every object of a cluster export",
+			yaml:     export,
+			key:      "core/ConfigMap/default/rendered",
+			expected: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "rendered"}},
+		},
+		{
+			name: "auto keeps rendered manifests",
+			yaml: rendered,
+			key:  "core/ConfigMap/default/rendered",
+			expected: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata": map[string]interface{}{
+					"name":        "rendered",
+					"annotations": map[string]interface{}{"kubectl.kubernetes.io/last-applied-configuration": "{}"},
+				},
+				"status": map[string]interface{}{"phase": "Active"},
+			},
+		},
+		{
+			name:     "always",
+			yaml:     rendered,
+			policy:   ServerFieldsStrip,
+			key:      "core/ConfigMap/default/rendered",
+			expected: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": map[string]interface{}{"name": "rendered"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := ParseManifest(strings.NewReader(tt.yaml), ParseOptions{ServerFields: tt.policy})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if obj := manifest.Objects[tt.key]; !reflect.DeepEqual(obj, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, obj)
+			}
+		})
+	}
+
+	manifest, err := ParseManifest(strings.NewReader(export), ParseOptions{ServerFields: ServerFieldsKeep})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := manifest.Objects["core/ConfigMap/default/exported"]["status"]; !ok {
+		t.Errorf("expected status to be kept with %s", ServerFieldsKeep)
+	}
+}
+
+func TestIgnoreDirectives(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]interface{}
+		ignore      bool
+		fields      []string
+	}{
+		{name: "no annotations"},
+		{name: "ignore", annotations: map[string]interface{}{IgnoreAnnotation: "true"}, ignore: true},
+		{name: "ignore false", annotations: map[string]interface{}{IgnoreAnnotation: "false"}},
+		{name: "ignore invalid", annotations: map[string]interface{}{IgnoreAnnotation: "yes please"}},
+		{
+			name:        "fields",
+			annotations: map[string]interface{}{IgnoreFieldsAnnotation: " spec.replicas ,, metadata.labels.version"},
+			fields:      []string{"spec.replicas", "metadata.labels.version"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := map[string]interface{}{"metadata": map[string]interface{}{"annotations": tt.annotations}}
+			ignore, fields := IgnoreDirectives(obj)
+			if ignore != tt.ignore || !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("expected %v %v, got %v %v", tt.ignore, tt.fields, ignore, fields)
+			}
+		})
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	tests := []struct {
+		image  string
+		policy string
+	}{
+		{"nginx", "Always"},
+		{"nginx:latest", "Always"},
+		{"nginx:1.27", "IfNotPresent"},
+		{"registry.example.com:5000/nginx", "Always"},
+		{"registry.example.com:5000/nginx:1.27", "IfNotPresent"},
+		{"nginx@sha256:abcd", "IfNotPresent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			pod := map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "app", "image": tt.image}},
+				},
+			}
+
+			defaulted := WithDefaults(pod)
+			container := defaulted["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+			if container["imagePullPolicy"] != tt.policy {
+				t.Errorf("expected imagePullPolicy %s, got %v", tt.policy, container["imagePullPolicy"])
+			}
+			if _, ok := pod["spec"].(map[string]interface{})["restartPolicy"]; ok {
+				t.Errorf("expected the input to be left unchanged")
+			}
+		})
+	}
+
+	configMap := map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}
+	if defaulted := WithDefaults(configMap); !reflect.DeepEqual(defaulted, configMap) {
+		t.Errorf("expected kinds without defaults to be returned as they are, got %v", defaulted)
+	}
+}
+
+func TestDecodeSecret(t *testing.T) {
+	secret := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"data": map[string]interface{}{
+			"password": "c2VjcmV0",    // secret
+			"unpadded": "YWI",         // ab
+			"wrapped":  "aGVs\nbG8=",  // hello
+			"binary":   "//79",        // not UTF-8
+			"invalid":  "not base64!", // kept as written
+			"replaced": "b2xk",        // overridden by stringData
+		},
+		"stringData": map[string]interface{}{
+			"replaced": "new",
+			"token":    "abc123",
+		},
+	}
+
+	expected := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"data": map[string]interface{}{
+			"password": "secret",
+			"unpadded": "ab",
+			"wrapped":  "hello",
+			"binary":   "//79",
+			"invalid":  "not base64!",
+			"replaced": "new",
+			"token":    "abc123",
+		},
+	}
+	if decoded := DecodeSecret(secret); !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected %v, got %v", expected, decoded)
+	}
+	if _, ok := secret["stringData"]; !ok {
+		t.Errorf("expected the input to be left unchanged")
+	}
+
+	onlyStringData := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"stringData": map[string]interface{}{"token": "abc123"},
+	}
+	if data := DecodeSecret(onlyStringData)["data"]; !reflect.DeepEqual(data, map[string]interface{}{"token": "abc123"}) {
+		t.Errorf("expected stringData to become data, got %v", data)
+	}
+
+	configMap := map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "data": map[string]interface{}{"a": "YWI="}}
+	if decoded := DecodeSecret(configMap); !reflect.DeepEqual(decoded, configMap) {
+		t.Errorf("expected other kinds to be returned as they are, got %v", decoded)
+	}
+}
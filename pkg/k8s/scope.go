@@ -0,0 +1,81 @@
+package k8s
+
+import "maps"
+
+// clusterScopedKinds lists the built-in kinds that are not namespaced, keyed by group/kind
+var clusterScopedKinds = map[string]bool{
+	"core/Namespace":        true,
+	"core/Node":             true,
+	"core/PersistentVolume": true,
+	"core/ComponentStatus":  true,
+
+	"rbac.authorization.k8s.io/ClusterRole":        true,
+	"rbac.authorization.k8s.io/ClusterRoleBinding": true,
+
+	"apiextensions.k8s.io/CustomResourceDefinition": true,
+	"apiregistration.k8s.io/APIService":             true,
+
+	"admissionregistration.k8s.io/MutatingWebhookConfiguration":     true,
+	"admissionregistration.k8s.io/ValidatingWebhookConfiguration":   true,
+	"admissionregistration.k8s.io/ValidatingAdmissionPolicy":        true,
+	"admissionregistration.k8s.io/ValidatingAdmissionPolicyBinding": true,
+
+	"storage.k8s.io/StorageClass":     true,
+	"storage.k8s.io/CSIDriver":        true,
+	"storage.k8s.io/CSINode":          true,
+	"storage.k8s.io/VolumeAttachment": true,
+
+	"scheduling.k8s.io/PriorityClass":                         true,
+	"networking.k8s.io/IngressClass":                          true,
+	"node.k8s.io/RuntimeClass":                                true,
+	"policy/PodSecurityPolicy":                                true,
+	"certificates.k8s.io/CertificateSigningRequest":           true,
+	"flowcontrol.apiserver.k8s.io/FlowSchema":                 true,
+	"flowcontrol.apiserver.k8s.io/PriorityLevelConfiguration": true,
+	"resource.k8s.io/DeviceClass":                             true,
+}
+
+// Scopes records which kinds are cluster-scoped, keyed by group/kind
+type Scopes map[string]bool
+
+// NewScopes returns the scopes of the built-in Kubernetes kinds
+func NewScopes() Scopes {
+	scopes := make(Scopes, len(clusterScopedKinds))
+	for kind := range clusterScopedKinds {
+		scopes[kind] = true
+	}
+	return scopes
+}
+
+// IsClusterScoped reports whether objects of the given group and kind have no namespace
+func (s Scopes) IsClusterScoped(group, kind string) bool {
+	return s[CanonicalGroup(group, kind)+"/"+kind]
+}
+
+// AddCRD records the scope of the kind defined by a CustomResourceDefinition.
+// Objects that are not CRDs are ignored.
+func (s Scopes) AddCRD(obj map[string]interface{}) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	group, _ := SplitAPIVersion(apiVersion)
+	if group != "apiextensions.k8s.io" || obj["kind"] != "CustomResourceDefinition" {
+		return
+	}
+
+	spec, _ := obj["spec"].(map[string]interface{})
+	names, _ := spec["names"].(map[string]interface{})
+	crdGroup, _ := spec["group"].(string)
+	kind, _ := names["kind"].(string)
+	if crdGroup == "" || kind == "" {
+		return
+	}
+	s[crdGroup+"/"+kind] = spec["scope"] == "Cluster"
+}
+
+// Merge returns the scopes recorded in s or other, as other records them for
+// kinds in both
+func (s Scopes) Merge(other Scopes) Scopes {
+	merged := make(Scopes, len(s)+len(other))
+	maps.Copy(merged, s)
+	maps.Copy(merged, other)
+	return merged
+}
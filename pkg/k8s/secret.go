@@ -0,0 +1,65 @@
+package k8s
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf8"
+)
+
+// LastAppliedAnnotation holds the previous manifest written by kubectl apply,
+// including the data of Secrets
+const LastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// IsSecret checks whether an object is a core Secret
+func IsSecret(obj map[string]interface{}) bool {
+	return obj["apiVersion"] == "v1" && obj["kind"] == "Secret"
+}
+
+// DecodeSecret returns a copy of a Secret with stringData merged into data,
+// as the API server does on write, and the values of data decoded from
+// base64, so the same value written in stringData or encoded differently
+// compares equal. Values that do not decode to UTF-8 text keep their
+// canonical base64 form, and values that are not base64 are kept as written.
+// Other objects are returned as is.
+func DecodeSecret(obj map[string]interface{}) map[string]interface{} {
+	if !IsSecret(obj) {
+		return obj
+	}
+
+	decoded := deepCopy(obj).(map[string]interface{})
+	data, _ := decoded["data"].(map[string]interface{})
+	for key, value := range data {
+		if encoded, ok := value.(string); ok {
+			data[key] = decodeSecretValue(encoded)
+		}
+	}
+
+	if stringData, ok := decoded["stringData"].(map[string]interface{}); ok {
+		if data == nil && len(stringData) > 0 {
+			data = make(map[string]interface{}, len(stringData))
+			decoded["data"] = data
+		}
+		for key, value := range stringData {
+			data[key] = value
+		}
+		delete(decoded, "stringData")
+	}
+	return decoded
+}
+
+// decodeSecretValue decodes a base64 value of Secret data, ignoring line
+// breaks and missing padding
+func decodeSecretValue(encoded string) string {
+	compact := strings.Join(strings.Fields(encoded), "")
+	value, err := base64.StdEncoding.DecodeString(compact)
+	if err != nil {
+		value, err = base64.RawStdEncoding.DecodeString(compact)
+	}
+	if err != nil {
+		return encoded
+	}
+	if !utf8.Valid(value) {
+		return base64.StdEncoding.EncodeToString(value)
+	}
+	return string(value)
+}
@@ -0,0 +1,92 @@
+package k8s
+
+import "fmt"
+
+// ServerFieldsPolicy selects when fields populated by the API server are removed
+type ServerFieldsPolicy string
+
+const (
+	// ServerFieldsAuto strips server fields from inputs that look like a
+	// cluster export, i.e. any object has a uid, resourceVersion or managedFields.
+	// This is the default.
+	ServerFieldsAuto ServerFieldsPolicy = "auto"
+	// ServerFieldsStrip always strips server fields
+	ServerFieldsStrip ServerFieldsPolicy = "always"
+	// ServerFieldsKeep never strips server fields
+	ServerFieldsKeep ServerFieldsPolicy = "never"
+)
+
+// ParseServerFieldsPolicy validates a server fields policy name
+func ParseServerFieldsPolicy(name string) (ServerFieldsPolicy, error) {
+	switch policy := ServerFieldsPolicy(name); policy {
+	case ServerFieldsAuto, ServerFieldsStrip, ServerFieldsKeep:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown server fields policy %q (expected auto, always or never)", name)
+	}
+}
+
+// serverMetadataFields lists the metadata fields set by the API server
+var serverMetadataFields = []string{
+	"uid",
+	"resourceVersion",
+	"generation",
+	"creationTimestamp",
+	"managedFields",
+	"selfLink",
+}
+
+// serverAnnotations lists annotations written by kubectl and controllers, or
+// deprecated ones that only record history
+var serverAnnotations = []string{
+	LastAppliedAnnotation,
+	"deployment.kubernetes.io/revision",
+	"kubernetes.io/change-cause",
+	"pv.kubernetes.io/bind-completed",
+	"pv.kubernetes.io/bound-by-controller",
+	"pv.kubernetes.io/provisioned-by",
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+	"control-plane.alpha.kubernetes.io/leader",
+	"autoscaling.alpha.kubernetes.io/conditions",
+	"autoscaling.alpha.kubernetes.io/current-metrics",
+}
+
+// LooksLikeClusterExport checks whether an object was read back from a
+// cluster rather than written by hand or rendered from templates
+func LooksLikeClusterExport(obj map[string]interface{}) bool {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	for _, field := range []string{"uid", "resourceVersion", "managedFields"} {
+		if _, ok := metadata[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// StripServerFields removes the fields the API server populates from obj:
+// status, server-set metadata and kubectl/controller annotations.
+// metadata.annotations is removed when no annotations are left.
+func StripServerFields(obj map[string]interface{}) {
+	delete(obj, "status")
+
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, field := range serverMetadataFields {
+		delete(metadata, field)
+	}
+
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, annotation := range serverAnnotations {
+		delete(annotations, annotation)
+	}
+	if len(annotations) == 0 {
+		delete(metadata, "annotations")
+	}
+}
@@ -28,7 +28,7 @@ warn contains msg if {
     behavior_changes := [path |
         some path, field_change in change.change.changes
         startswith(path, "spec.behavior.")
-        field_change.from == null  # Field was added
+        field_change.action == "add"
     ]
     count(behavior_changes) > 0
     
@@ -43,9 +43,10 @@ warn contains msg if {
     change.change.actions[_] == "update"
     change.change.after.spec.type == "LoadBalancer"
     
-    # Check if loadBalancerSourceRanges was added using changes field
-    ranges_change := change.change.changes["spec.loadBalancerSourceRanges"]
-    ranges_change.from == null  # Field was added
+    # Check if loadBalancerSourceRanges were added using changes field
+    some path, field_change in change.change.changes
+    startswith(path, "spec.loadBalancerSourceRanges[")
+    field_change.action == "add"
     
     msg := sprintf("Service '%s' in namespace '%s' now has loadBalancerSourceRanges restrictions", 
                    [change.name, change.namespace])
@@ -51,4 +51,13 @@ warn contains msg if {
     
     msg := sprintf("ConfigMap '%s' in namespace '%s' has %d data field(s) modified", 
                    [change.name, change.namespace, count(changed_fields)])
-}
\ No newline at end of file
+}
+
+# Deny: changes to immutable fields that force the resource to be recreated
+deny contains msg if {
+    change := input.resource_changes[_]
+    change.change.actions == ["delete", "create"]
+
+    msg := sprintf("%s '%s' in namespace '%s' must be recreated because immutable fields changed: %v",
+                   [change.type, change.name, change.namespace, change.change.replace_paths])
+}
@@ -102,5 +102,16 @@ else
     echo "❌ Expected Service policy warning but got exit code: $EXIT_CODE"
 fi
 
+echo
+# Test 8: Immutable field changes - expect failure
+echo "Test 8: Immutable field changes - expect failures"
+EXIT_CODE=0
+./skiff test/test-cases/immutable-before.yaml test/test-cases/immutable-after.yaml | conftest test --policy test/test-policies/policy.rego - || EXIT_CODE=$?
+if [ $EXIT_CODE -eq 1 ]; then
+    echo "✅ Policy correctly caught resource replacement"
+else
+    echo "❌ Expected policy failures but got exit code: $EXIT_CODE"
+fi
+
 echo
 echo "🎯 Policy integration tests completed"
\ No newline at end of file